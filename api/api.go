@@ -5,7 +5,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/mattermost/rotator/model"
-	rotator "github.com/mattermost/rotator/rotator"
+	"github.com/mattermost/rotator/rotator"
 )
 
 // Register registers the API endpoints on the given router.
@@ -13,6 +13,7 @@ func Register(rootRouter *mux.Router, context *Context) {
 	apiRouter := rootRouter.PathPrefix("/api").Subrouter()
 
 	initCluster(apiRouter, context)
+	initSchedule(apiRouter, context)
 }
 
 // initCluster registers RDS cluster endpoints on the given router.
@@ -23,12 +24,32 @@ func initCluster(apiRouter *mux.Router, context *Context) {
 
 	clustersRouter := apiRouter.PathPrefix("/rotate").Subrouter()
 	clustersRouter.Handle("", addContext(handleRotateCluster)).Methods("POST")
+	clustersRouter.Handle("/{id:[A-Za-z0-9]{26}}", addContext(handleGetRotation)).Methods("GET")
+	clustersRouter.Handle("/{id:[A-Za-z0-9]{26}}", addContext(handleCancelRotation)).Methods("DELETE")
+	clustersRouter.Handle("/{id:[A-Za-z0-9]{26}}/pause", addContext(handlePauseRotation)).Methods("POST")
+	clustersRouter.Handle("/{id:[A-Za-z0-9]{26}}/resume", addContext(handleResumeRotation)).Methods("POST")
 
 	nodeRouter := apiRouter.PathPrefix("/drain").Subrouter()
 	nodeRouter.Handle("", addContext(handleDrainNode)).Methods("POST")
+	nodeRouter.Handle("/{id:[A-Za-z0-9]{26}}", addContext(handleGetDrain)).Methods("GET")
+	nodeRouter.Handle("/{id:[A-Za-z0-9]{26}}", addContext(handleCancelDrain)).Methods("DELETE")
 
 }
 
+// initSchedule registers scheduled rotation endpoints on the given router.
+func initSchedule(apiRouter *mux.Router, context *Context) {
+	addContext := func(handler contextHandlerFunc) *contextHandler {
+		return newContextHandler(context, handler)
+	}
+
+	schedulesRouter := apiRouter.PathPrefix("/schedules").Subrouter()
+	schedulesRouter.Handle("", addContext(handleCreateSchedule)).Methods("POST")
+	schedulesRouter.Handle("", addContext(handleGetSchedules)).Methods("GET")
+	schedulesRouter.Handle("/{id:[A-Za-z0-9]{26}}", addContext(handleGetSchedule)).Methods("GET")
+	schedulesRouter.Handle("/{id:[A-Za-z0-9]{26}}", addContext(handleUpdateSchedule)).Methods("PUT")
+	schedulesRouter.Handle("/{id:[A-Za-z0-9]{26}}", addContext(handleDeleteSchedule)).Methods("DELETE")
+}
+
 // handleRotateCluster responds to POST /api/rotate, beginning the process of rotating a k8s cluster.
 // sample body:
 //
@@ -41,7 +62,49 @@ func initCluster(apiRouter *mux.Router, context *Context) {
 //	    "EvictGracePeriod": 60,
 //	    "WaitBetweenRotations": 60,
 //	    "WaitBetweenDrains": 60,
+//	    "dryRun": false,
+//	    "driftOnly": false,
+//	    "maxNodeAge": "720h",
+//	    "strategy": "surge",
+//	    "standby": false,
+//	    "failurePolicy": "rollback",
+//	    "autoscalingGroups": ["nodes.cluster1"],
+//	    "clusterTagKeys": ["KubernetesCluster", "kubernetes.io/cluster/{clusterID}"],
+//	    "masterTagKey": "k8s.io/role/master",
+//	    "includeAutoscalingGroups": ["nodes.cluster1"],
+//	    "excludeAutoscalingGroups": [],
+//	    "nodes": ["ip-10-0-0-1.ec2.internal"],
+//	    "labelSelector": "kops.k8s.io/instancegroup=nodes",
+//	    "parallelGroups": 2,
+//	    "maxDrainingNodes": 2,
+//	    "suspendAZRebalance": true,
+//	    "suspendProcesses": ["ReplaceUnhealthy", "ScheduledActions"],
+//	    "disableScaleDown": true,
+//	    "pdbPolicy": "wait",
+//	    "pdbWaitTimeout": "10m",
+//	    "evictByPriority": true,
+//	    "evictionNamespaceTiers": [["databases"], ["ingress-nginx"]],
+//	    "completionTimeout": "30m",
+//	    "completionPolicy": "evict",
+//	    "maxConcurrentEvictions": 10
 //	}
+//
+// With dryRun set, no node is rotated and the rotation plan is returned instead.
+// With driftOnly set, only nodes that differ from their autoscaling group are rotated.
+// With maxNodeAge set, only nodes older than the given duration are rotated, oldest first.
+// With the surge strategy, worker ASGs are scaled up before nodes are drained instead of after.
+// With standby set, worker nodes are put in standby instead of detached, so that they can be returned to service.
+// The failure policy decides whether a batch of worker nodes that fails to rotate aborts, rolls back or is skipped.
+// ASGs are discovered by their cluster tags unless autoscalingGroups names them.
+// The ASG lists, nodes and label selector narrow the rotation to the nodes matching all of them.
+// With parallelGroups set, up to that many worker ASGs are rotated at once, draining up to maxDrainingNodes nodes.
+// With suspendAZRebalance set, ASGs do not rebalance their availability zones while they are rotated.
+// The suspendProcesses of ASGs are suspended while they are rotated and resumed afterwards.
+// With disableScaleDown set, cluster-autoscaler does not scale down the nodes being rotated.
+// With evictByPriority or evictionNamespaceTiers set, the pods of each node are evicted in tiers.
+// Pods annotated to be waited for are waited for up to completionTimeout, after which the completion policy fails the drain or evicts them.
+// Up to maxConcurrentEvictions pods of each node are evicted at once.
+// The PDB policy decides whether batches of nodes whose pods PodDisruptionBudgets do not allow to evict are drained anyway, delayed or refused.
 func handleRotateCluster(c *Context, w http.ResponseWriter, r *http.Request) {
 
 	rotateClusterRequest, err := model.NewRotateClusterRequestFromReader(r.Body)
@@ -51,27 +114,34 @@ func handleRotateCluster(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cluster := model.Cluster{
-		ClusterID:               rotateClusterRequest.ClusterID,
-		MaxScaling:              rotateClusterRequest.MaxScaling,
-		RotateMasters:           rotateClusterRequest.RotateMasters,
-		RotateWorkers:           rotateClusterRequest.RotateWorkers,
-		MaxDrainRetries:         rotateClusterRequest.MaxDrainRetries,
-		EvictGracePeriod:        rotateClusterRequest.EvictGracePeriod,
-		WaitBetweenRotations:    rotateClusterRequest.WaitBetweenRotations,
-		WaitBetweenDrains:       rotateClusterRequest.WaitBetweenDrains,
-		WaitBetweenPodEvictions: rotateClusterRequest.WaitBetweenPodEvictions,
-	}
+	cluster := rotateClusterRequest.ToCluster()
 
-	rotatorMetada := rotator.RotatorMetadata{}
+	if rotateClusterRequest.DryRun {
+		plan, err := rotator.PlanRotateCluster(r.Context(), cluster, c.Logger.WithField("cluster", cluster.ClusterID))
+		if err != nil {
+			c.Logger.WithError(err).Error("failed to plan cluster rotation")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 
-	go rotator.InitRotateCluster(&cluster, &rotatorMetada, c.Logger.WithField("cluster", cluster.ClusterID))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		outputJSON(c, w, plan)
+		return
+	}
+
+	job, err := c.Jobs.StartRotation(cluster)
+	if err != nil {
+		writeJobError(c, w, err, http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
-	outputJSON(c, w, cluster)
+	outputJSON(c, w, job)
 }
 
+// handleDrainNode responds to POST /api/drain, beginning the process of draining a k8s node.
 func handleDrainNode(c *Context, w http.ResponseWriter, r *http.Request) {
 
 	drainNodeRequest, err := model.NewDrainNodeRequestFromReader(r.Body)
@@ -87,13 +157,230 @@ func handleDrainNode(c *Context, w http.ResponseWriter, r *http.Request) {
 		MaxDrainRetries:         drainNodeRequest.MaxDrainRetries,
 		WaitBetweenPodEvictions: drainNodeRequest.WaitBetweenPodEvictions,
 		DetachNode:              drainNodeRequest.DetachNode,
+		StandbyNode:             drainNodeRequest.StandbyNode,
 		TerminateNode:           drainNodeRequest.TerminateNode,
 		ClusterID:               drainNodeRequest.ClusterID,
+		ClusterTagKeys:          drainNodeRequest.ClusterTagKeys,
+		EvictByPriority:         drainNodeRequest.EvictByPriority,
+		EvictionNamespaceTiers:  drainNodeRequest.EvictionNamespaceTiers,
+		CompletionTimeout:       drainNodeRequest.GetCompletionTimeout(),
+		CompletionPolicy:        drainNodeRequest.CompletionPolicy,
+		MaxConcurrentEvictions:  drainNodeRequest.MaxConcurrentEvictions,
+	}
+
+	job, err := c.Jobs.StartDrain(&node)
+	if err != nil {
+		writeJobError(c, w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	outputJSON(c, w, job)
+}
+
+// handleGetRotation responds to GET /api/rotate/{id}, returning the status of a cluster rotation job.
+func handleGetRotation(c *Context, w http.ResponseWriter, r *http.Request) {
+	handleGetJob(c, w, r, model.JobTypeRotate)
+}
+
+// handleGetDrain responds to GET /api/drain/{id}, returning the status of a node drain job.
+func handleGetDrain(c *Context, w http.ResponseWriter, r *http.Request) {
+	handleGetJob(c, w, r, model.JobTypeDrain)
+}
+
+func handleGetJob(c *Context, w http.ResponseWriter, r *http.Request, jobType string) {
+	vars := mux.Vars(r)
+	jobID := vars["id"]
+	c.Logger = c.Logger.WithField("job", jobID)
+
+	job := c.Jobs.Get(jobID)
+	if job == nil || job.Type != jobType {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, job)
+}
+
+// handleCancelRotation responds to DELETE /api/rotate/{id}, stopping a cluster rotation job at its next safe point.
+func handleCancelRotation(c *Context, w http.ResponseWriter, r *http.Request) {
+	handleCancelJob(c, w, r, model.JobTypeRotate)
+}
+
+// handleCancelDrain responds to DELETE /api/drain/{id}, stopping a node drain job at its next safe point.
+func handleCancelDrain(c *Context, w http.ResponseWriter, r *http.Request) {
+	handleCancelJob(c, w, r, model.JobTypeDrain)
+}
+
+func handleCancelJob(c *Context, w http.ResponseWriter, r *http.Request, jobType string) {
+	vars := mux.Vars(r)
+	jobID := vars["id"]
+	c.Logger = c.Logger.WithField("job", jobID)
+
+	job := c.Jobs.Get(jobID)
+	if job == nil || job.Type != jobType {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if job.IsDone() {
+		c.Logger.Warnf("unable to cancel job in state %s", job.State)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	job = c.Jobs.Cancel(jobID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	outputJSON(c, w, job)
+}
+
+// handlePauseRotation responds to POST /api/rotate/{id}/pause, holding a cluster rotation job once its current batch of nodes is rotated.
+func handlePauseRotation(c *Context, w http.ResponseWriter, r *http.Request) {
+	handleChangeRotation(c, w, r, c.Jobs.Pause)
+}
+
+// handleResumeRotation responds to POST /api/rotate/{id}/resume, continuing a paused or cancelled cluster rotation job.
+func handleResumeRotation(c *Context, w http.ResponseWriter, r *http.Request) {
+	handleChangeRotation(c, w, r, c.Jobs.Resume)
+}
+
+func handleChangeRotation(c *Context, w http.ResponseWriter, r *http.Request, change func(id string) (*model.Job, error)) {
+	vars := mux.Vars(r)
+	jobID := vars["id"]
+	c.Logger = c.Logger.WithField("job", jobID)
+
+	job := c.Jobs.Get(jobID)
+	if job == nil || job.Type != model.JobTypeRotate {
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
-	go rotator.InitDrainNode(&node, c.Logger.WithField("node", node.NodeName))
+	job, err := change(jobID)
+	if err != nil {
+		writeJobError(c, w, err, http.StatusBadRequest)
+		return
+	}
+	if job == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
-	outputJSON(c, w, node)
+	outputJSON(c, w, job)
+}
+
+// handleCreateSchedule responds to POST /api/schedules, creating a scheduled cluster rotation.
+// sample body:
+//
+//	{
+//	    "cron": "0 3 * * 2",
+//	    "window": "Tue-Thu 02:00-05:00 UTC",
+//	    "rotation": {
+//	        "clusterID": "12345678",
+//	        "maxScaling": 2,
+//	        "rotateMasters":  true,
+//	        "rotateWorkers": true
+//	    }
+//	}
+//
+// A due rotation is launched once the maintenance window is open, and paused
+// while the window is closed.
+func handleCreateSchedule(c *Context, w http.ResponseWriter, r *http.Request) {
+	scheduleRequest, err := model.NewScheduleRequestFromReader(r.Body)
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to decode request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := c.Schedules.Create(scheduleRequest)
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to create schedule")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	outputJSON(c, w, schedule)
+}
+
+// handleGetSchedules responds to GET /api/schedules, returning all the scheduled cluster rotations.
+func handleGetSchedules(c *Context, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, c.Schedules.List())
+}
+
+// handleGetSchedule responds to GET /api/schedules/{id}, returning a scheduled cluster rotation.
+func handleGetSchedule(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scheduleID := vars["id"]
+	c.Logger = c.Logger.WithField("schedule", scheduleID)
+
+	schedule := c.Schedules.Get(scheduleID)
+	if schedule == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, schedule)
+}
+
+// handleUpdateSchedule responds to PUT /api/schedules/{id}, replacing the parameters of a scheduled cluster rotation.
+func handleUpdateSchedule(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scheduleID := vars["id"]
+	c.Logger = c.Logger.WithField("schedule", scheduleID)
+
+	scheduleRequest, err := model.NewScheduleRequestFromReader(r.Body)
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to decode request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := c.Schedules.Update(scheduleID, scheduleRequest)
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to update schedule")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if schedule == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	outputJSON(c, w, schedule)
+}
+
+// handleDeleteSchedule responds to DELETE /api/schedules/{id}, deleting a scheduled cluster rotation.
+// Rotations already launched by the schedule keep running.
+func handleDeleteSchedule(c *Context, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scheduleID := vars["id"]
+	c.Logger = c.Logger.WithField("schedule", scheduleID)
+
+	schedule, err := c.Schedules.Delete(scheduleID)
+	if err != nil {
+		c.Logger.WithError(err).Error("failed to delete schedule")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if schedule == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
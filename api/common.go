@@ -3,6 +3,10 @@ package api
 import (
 	"encoding/json"
 	"io"
+	"net/http"
+
+	"github.com/mattermost/rotator/model"
+	"github.com/pkg/errors"
 )
 
 // outputJSON is a helper method to write the given data as JSON to the given writer.
@@ -16,3 +20,18 @@ func outputJSON(c *Context, w io.Writer, data interface{}) {
 		c.Logger.WithError(err).Error("failed to encode result")
 	}
 }
+
+// writeJobError responds with the status code matching an error returned when starting or changing a job.
+func writeJobError(c *Context, w http.ResponseWriter, err error, defaultStatusCode int) {
+	var lockedErr *model.ClusterLockedError
+	if errors.As(err, &lockedErr) {
+		c.Logger.WithError(err).Warn("cluster is locked by another job")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		outputJSON(c, w, lockedErr)
+		return
+	}
+
+	c.Logger.WithError(err).Error("failed to handle job")
+	w.WriteHeader(defaultStatusCode)
+}
@@ -1,11 +1,35 @@
 package api
 
-import "github.com/sirupsen/logrus"
+import (
+	"github.com/mattermost/rotator/model"
+	"github.com/sirupsen/logrus"
+)
+
+// Jobs describes the interface required to start and track rotation and drain jobs.
+type Jobs interface {
+	StartRotation(cluster *model.Cluster) (*model.Job, error)
+	StartDrain(node *model.NodeDrain) (*model.Job, error)
+	Get(id string) *model.Job
+	Cancel(id string) *model.Job
+	Pause(id string) (*model.Job, error)
+	Resume(id string) (*model.Job, error)
+}
+
+// Schedules describes the interface required to manage scheduled rotations.
+type Schedules interface {
+	Create(request *model.ScheduleRequest) (*model.Schedule, error)
+	Get(id string) *model.Schedule
+	List() []*model.Schedule
+	Update(id string, request *model.ScheduleRequest) (*model.Schedule, error)
+	Delete(id string) (*model.Schedule, error)
+}
 
 // Context provides the API with all necessary data and interfaces for responding to requests.
 //
 // It is cloned before each request, allowing per-request changes such as logger annotations.
 type Context struct {
+	Jobs      Jobs
+	Schedules Schedules
 	RequestID string
 	Logger    logrus.FieldLogger
 }
@@ -13,6 +37,8 @@ type Context struct {
 // Clone creates a shallow copy of context, allowing clones to apply per-request changes.
 func (c *Context) Clone() *Context {
 	return &Context{
-		Logger: c.Logger,
+		Jobs:      c.Jobs,
+		Schedules: c.Schedules,
+		Logger:    c.Logger,
 	}
 }
@@ -1,89 +1,293 @@
 package aws
 
 import (
+	"context"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/mattermost/rotator/model"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
-// GetNodeHostnames returns the hostnames of the autoscaling group nodes.
-func GetNodeHostnames(autoscalingGroupNodes []*autoscaling.Instance) ([]string, error) {
+// instanceIDPattern matches the IDs of EC2 instances.
+var instanceIDPattern = regexp.MustCompile(`^i-[0-9a-f]{8,17}$`)
+
+// Provider is the AWS implementation of model.NodeGroupProvider, backed by
+// EC2 instances and AutoScaling groups.
+type Provider struct {
+	ec2         ec2iface.EC2API
+	autoscaling autoscalingiface.AutoScalingAPI
+}
+
+// NewProvider creates an AWS provider using the shared AWS configuration and credentials.
+func NewProvider() *Provider {
 	sess := session.Must(session.NewSessionWithOptions(session.Options{
 		SharedConfigState: session.SharedConfigEnable,
 	}))
-	svc := ec2.New(sess)
-	var instanceHostnames []string
-	for _, node := range autoscalingGroupNodes {
-		resp, err := svc.DescribeInstances(&ec2.DescribeInstancesInput{
-			InstanceIds: []*string{aws.String(*node.InstanceId)},
-		})
+
+	return NewProviderWithClients(ec2.New(sess), autoscaling.New(sess))
+}
+
+// NewProviderWithClients creates an AWS provider using the given EC2 and AutoScaling clients.
+func NewProviderWithClients(ec2Client ec2iface.EC2API, autoscalingClient autoscalingiface.AutoScalingAPI) *Provider {
+	return &Provider{
+		ec2:         ec2Client,
+		autoscaling: autoscalingClient,
+	}
+}
+
+// GetNodeGroups returns the autoscaling groups of the cluster identified by the selector.
+func (p *Provider) GetNodeGroups(ctx context.Context, selector *model.NodeGroupSelector) ([]*model.NodeGroup, error) {
+	asgs, err := p.GetAutoscalingGroups(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodeGroups []*model.NodeGroup
+	for _, asg := range asgs {
+		nodeGroup, err := p.nodeGroup(ctx, asg)
 		if err != nil {
-			return nil, errors.Wrap(err, "Failed to describe ec2 instance")
+			return nil, err
 		}
-		instanceHostnames = append(instanceHostnames, *resp.Reservations[0].Instances[0].PrivateDnsName)
+		nodeGroup.Master = selector.IsMaster(asgTags(asg))
+		nodeGroups = append(nodeGroups, nodeGroup)
+	}
+
+	return nodeGroups, nil
+}
+
+// GetNodeGroup returns the autoscaling group with the given name.
+func (p *Provider) GetNodeGroup(ctx context.Context, name string) (*model.NodeGroup, error) {
+	asg, err := p.describeAutoscalingGroup(ctx, name)
+	if err != nil {
+		return nil, err
 	}
-	return instanceHostnames, nil
+
+	return p.nodeGroup(ctx, asg)
 }
 
-// GetInstanceID returns the instance ID of a node.
-func GetInstanceID(nodeName string, logger *logrus.Entry) (string, error) {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-	svc := ec2.New(sess)
-	resp, err := svc.DescribeInstances(&ec2.DescribeInstancesInput{
-		Filters: []*ec2.Filter{
-			{
-				Name:   aws.String("private-dns-name"),
-				Values: []*string{aws.String(nodeName)},
-			},
-		},
+// nodeGroup converts an autoscaling group to a node group.
+func (p *Provider) nodeGroup(ctx context.Context, asg *autoscaling.Group) (*model.NodeGroup, error) {
+	ec2Instances, err := p.describeInstances(ctx, asg.Instances)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get node names of autoscaling group %s", aws.StringValue(asg.AutoScalingGroupName))
+	}
+
+	nodeGroup := &model.NodeGroup{
+		Name:            aws.StringValue(asg.AutoScalingGroupName),
+		DesiredCapacity: int(aws.Int64Value(asg.DesiredCapacity)),
+		MaxSize:         int(aws.Int64Value(asg.MaxSize)),
+	}
+	for _, process := range asg.SuspendedProcesses {
+		nodeGroup.SuspendedProcesses = append(nodeGroup.SuspendedProcesses, aws.StringValue(process.ProcessName))
+	}
+
+	err = p.setLaunchConfiguration(ctx, nodeGroup, asg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get launch configuration of autoscaling group %s", nodeGroup.Name)
+	}
+
+	for i, instance := range asg.Instances {
+		nodeGroup.Instances = append(nodeGroup.Instances, model.Instance{
+			ID:                  aws.StringValue(instance.InstanceId),
+			NodeName:            aws.StringValue(ec2Instances[i].PrivateDnsName),
+			AvailabilityZone:    aws.StringValue(instance.AvailabilityZone),
+			LaunchConfiguration: instanceLaunchConfiguration(instance),
+			ImageID:             aws.StringValue(ec2Instances[i].ImageId),
+			InstanceType:        aws.StringValue(instance.InstanceType),
+			LaunchTime:          aws.TimeValue(ec2Instances[i].LaunchTime),
+			Standby:             isStandby(instance),
+		})
+	}
+
+	return nodeGroup, nil
+}
+
+// describeInstances returns the EC2 descriptions of the autoscaling group instances, in the same order.
+func (p *Provider) describeInstances(ctx context.Context, autoscalingGroupNodes []*autoscaling.Instance) ([]*ec2.Instance, error) {
+	if len(autoscalingGroupNodes) == 0 {
+		return nil, nil
+	}
+
+	var instanceIDs []*string
+	for _, node := range autoscalingGroupNodes {
+		instanceIDs = append(instanceIDs, node.InstanceId)
+	}
+
+	instancesByID := make(map[string]*ec2.Instance)
+	err := p.ec2.DescribeInstancesPagesWithContext(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: instanceIDs,
+	}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				instancesByID[aws.StringValue(instance.InstanceId)] = instance
+			}
+		}
+		return true
 	})
 	if err != nil {
-		return "", errors.Wrap(err, "Failed to describe ec2 instance")
+		return nil, errors.Wrap(err, "Failed to describe ec2 instances")
 	}
 
-	if resp.Reservations == nil {
-		logger.Warnf("Instance %s not found, assuming that instance was already deleted", nodeName)
-		return "", nil
+	var instances []*ec2.Instance
+	for _, node := range autoscalingGroupNodes {
+		instance, ok := instancesByID[aws.StringValue(node.InstanceId)]
+		if !ok {
+			return nil, errors.Errorf("ec2 instance %s not found", aws.StringValue(node.InstanceId))
+		}
+		instances = append(instances, instance)
 	}
 
-	return *resp.Reservations[0].Instances[0].InstanceId, nil
+	return instances, nil
 }
 
-// DetachNodes detaches nodes from an autoscaling group.
-func DetachNodes(decrement bool, nodesToDetach []string, autoscalingGroupName string, logger *logrus.Entry) error {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-	asgSvc := autoscaling.New(sess)
+// setLaunchConfiguration sets the launch template version or launch
+// configuration that new instances of the group are launched with, along with
+// their image and instance type.
+func (p *Provider) setLaunchConfiguration(ctx context.Context, nodeGroup *model.NodeGroup, asg *autoscaling.Group) error {
+	launchTemplate := asg.LaunchTemplate
+	mixedInstances := false
+	if launchTemplate == nil && asg.MixedInstancesPolicy != nil && asg.MixedInstancesPolicy.LaunchTemplate != nil {
+		launchTemplate = asg.MixedInstancesPolicy.LaunchTemplate.LaunchTemplateSpecification
+		mixedInstances = len(asg.MixedInstancesPolicy.LaunchTemplate.Overrides) > 0
+	}
 
-	for _, node := range nodesToDetach {
-		instanceID, err := GetInstanceID(node, logger)
+	if launchTemplate != nil {
+		version := aws.StringValue(launchTemplate.Version)
+		if version == "" {
+			version = "$Default"
+		}
+		resp, err := p.ec2.DescribeLaunchTemplateVersionsWithContext(ctx, &ec2.DescribeLaunchTemplateVersionsInput{
+			LaunchTemplateId:   launchTemplate.LaunchTemplateId,
+			LaunchTemplateName: launchTemplate.LaunchTemplateName,
+			Versions:           []*string{aws.String(version)},
+		})
 		if err != nil {
-			return errors.Wrapf(err, "Failed to detach node %s", node)
+			return errors.Wrap(err, "Failed to describe launch template version")
+		}
+		if len(resp.LaunchTemplateVersions) == 0 {
+			return errors.Errorf("launch template version %s not found", version)
 		}
 
-		if instanceID == "" {
-			logger.Infof("Instance %s does not exist. No detachment required", node)
-			return nil
+		templateVersion := resp.LaunchTemplateVersions[0]
+		nodeGroup.LaunchConfiguration = launchTemplateID(aws.StringValue(templateVersion.LaunchTemplateId), strconv.FormatInt(aws.Int64Value(templateVersion.VersionNumber), 10))
+		if templateVersion.LaunchTemplateData != nil {
+			nodeGroup.ImageID = resolvedImageID(aws.StringValue(templateVersion.LaunchTemplateData.ImageId))
+			if !mixedInstances {
+				nodeGroup.InstanceType = aws.StringValue(templateVersion.LaunchTemplateData.InstanceType)
+			}
 		}
+		return nil
+	}
 
-		nodeInGroup, err := nodeInAutoscalingGroup(autoscalingGroupName, instanceID)
+	if asg.LaunchConfigurationName != nil {
+		resp, err := p.autoscaling.DescribeLaunchConfigurationsWithContext(ctx, &autoscaling.DescribeLaunchConfigurationsInput{
+			LaunchConfigurationNames: []*string{asg.LaunchConfigurationName},
+		})
+		if err != nil {
+			return errors.Wrap(err, "Failed to describe launch configuration")
+		}
+		if len(resp.LaunchConfigurations) == 0 {
+			return errors.Errorf("launch configuration %s not found", aws.StringValue(asg.LaunchConfigurationName))
+		}
+
+		launchConfiguration := resp.LaunchConfigurations[0]
+		nodeGroup.LaunchConfiguration = launchConfigurationID(aws.StringValue(launchConfiguration.LaunchConfigurationName))
+		nodeGroup.ImageID = resolvedImageID(aws.StringValue(launchConfiguration.ImageId))
+		nodeGroup.InstanceType = aws.StringValue(launchConfiguration.InstanceType)
+	}
+
+	return nil
+}
+
+// instanceLaunchConfiguration returns the launch template version or launch
+// configuration the instance was launched with.
+func instanceLaunchConfiguration(instance *autoscaling.Instance) string {
+	if instance.LaunchTemplate != nil {
+		return launchTemplateID(aws.StringValue(instance.LaunchTemplate.LaunchTemplateId), aws.StringValue(instance.LaunchTemplate.Version))
+	}
+	if instance.LaunchConfigurationName != nil {
+		return launchConfigurationID(aws.StringValue(instance.LaunchConfigurationName))
+	}
+
+	return ""
+}
+
+func launchTemplateID(templateID, version string) string {
+	return fmt.Sprintf("launch-template/%s/%s", templateID, version)
+}
+
+func launchConfigurationID(name string) string {
+	return fmt.Sprintf("launch-configuration/%s", name)
+}
+
+// resolvedImageID returns the image ID, or an empty string if the image is
+// resolved at launch time, for example from an SSM parameter.
+func resolvedImageID(imageID string) string {
+	if !strings.HasPrefix(imageID, "ami-") {
+		return ""
+	}
+
+	return imageID
+}
+
+// GetInstanceID returns the instance ID of a node. Nodes named after the
+// private DNS name of their instance are looked up by that name, in any region,
+// and nodes named after their instance, as with resource name hostnames, by
+// the instance ID.
+func (p *Provider) GetInstanceID(ctx context.Context, nodeName string, logger *logrus.Entry) (string, error) {
+	filter := &ec2.Filter{
+		Name:   aws.String("private-dns-name"),
+		Values: []*string{aws.String(nodeName)},
+	}
+	if instanceID := instanceIDFromHostname(nodeName); instanceID != "" {
+		filter = &ec2.Filter{
+			Name:   aws.String("instance-id"),
+			Values: []*string{aws.String(instanceID)},
+		}
+	}
+
+	resp, err := p.ec2.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{filter},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to describe ec2 instance")
+	}
+
+	for _, reservation := range resp.Reservations {
+		for _, instance := range reservation.Instances {
+			if instance.State != nil && aws.StringValue(instance.State.Name) == ec2.InstanceStateNameTerminated {
+				continue
+			}
+			return aws.StringValue(instance.InstanceId), nil
+		}
+	}
+
+	logger.Warnf("Instance %s not found, assuming that instance was already deleted", nodeName)
+	return "", nil
+}
+
+// DetachNodes detaches instances from an autoscaling group.
+func (p *Provider) DetachNodes(ctx context.Context, decrement bool, instanceIDs []string, autoscalingGroupName string, logger *logrus.Entry) error {
+	for _, instanceID := range instanceIDs {
+		nodeInGroup, err := p.NodeInAutoscalingGroup(ctx, autoscalingGroupName, instanceID)
 		if err != nil {
 			return errors.Wrapf(err, "Failed to check if instance is member of the ASG")
 		}
 		if nodeInGroup {
 			logger.Infof("Detaching instance %s", instanceID)
-			_, err = asgSvc.DetachInstances(&autoscaling.DetachInstancesInput{
+			_, err = p.autoscaling.DetachInstancesWithContext(ctx, &autoscaling.DetachInstancesInput{
 				AutoScalingGroupName: aws.String(autoscalingGroupName),
 				InstanceIds: []*string{
 					aws.String(instanceID),
@@ -100,42 +304,172 @@ func DetachNodes(decrement bool, nodesToDetach []string, autoscalingGroupName st
 	return nil
 }
 
-// TerminateNodes terminates a slice of nodes.
-func TerminateNodes(nodesToTerminate []string, logger *logrus.Entry) error {
-	logger.Infof("Terminating %d nodes", len(nodesToTerminate))
-	for _, node := range nodesToTerminate {
-		var instanceID string
-		var err error
-		logger.Infof(node)
-		if matchesPatternPrivateDNS(node) {
-			instanceID, err = GetInstanceID(node, logger)
-		} else if matchesPatternID(node) {
-			instanceID = node
-		} else {
-			instanceID = ""
-			logger.Infof("Node %s is not a valid input", node)
-		}
+// SetCapacity changes the desired capacity and max size of an autoscaling group.
+func (p *Provider) SetCapacity(ctx context.Context, autoscalingGroupName string, desiredCapacity, maxSize int, logger *logrus.Entry) error {
+	logger.Infof("Setting desired capacity of autoscaling group %s to %d and max size to %d", autoscalingGroupName, desiredCapacity, maxSize)
+	_, err := p.autoscaling.UpdateAutoScalingGroupWithContext(ctx, &autoscaling.UpdateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(autoscalingGroupName),
+		DesiredCapacity:      aws.Int64(int64(desiredCapacity)),
+		MaxSize:              aws.Int64(int64(maxSize)),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to set capacity of autoscaling group %s", autoscalingGroupName)
+	}
 
+	return nil
+}
+
+// SuspendProcesses suspends the processes of an autoscaling group.
+func (p *Provider) SuspendProcesses(ctx context.Context, autoscalingGroupName string, processes []string, logger *logrus.Entry) error {
+	logger.Infof("Suspending processes %s of autoscaling group %s", strings.Join(processes, ", "), autoscalingGroupName)
+	_, err := p.autoscaling.SuspendProcessesWithContext(ctx, &autoscaling.ScalingProcessQuery{
+		AutoScalingGroupName: aws.String(autoscalingGroupName),
+		ScalingProcesses:     aws.StringSlice(processes),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to suspend processes of autoscaling group %s", autoscalingGroupName)
+	}
+
+	return nil
+}
+
+// ResumeProcesses resumes the suspended processes of an autoscaling group.
+func (p *Provider) ResumeProcesses(ctx context.Context, autoscalingGroupName string, processes []string, logger *logrus.Entry) error {
+	logger.Infof("Resuming processes %s of autoscaling group %s", strings.Join(processes, ", "), autoscalingGroupName)
+	_, err := p.autoscaling.ResumeProcessesWithContext(ctx, &autoscaling.ScalingProcessQuery{
+		AutoScalingGroupName: aws.String(autoscalingGroupName),
+		ScalingProcesses:     aws.StringSlice(processes),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to resume processes of autoscaling group %s", autoscalingGroupName)
+	}
+
+	return nil
+}
+
+// AttachNodes attaches instances to an autoscaling group.
+func (p *Provider) AttachNodes(ctx context.Context, instanceIDs []string, autoscalingGroupName string, logger *logrus.Entry) error {
+	for _, instanceID := range instanceIDs {
+		nodeInGroup, err := p.NodeInAutoscalingGroup(ctx, autoscalingGroupName, instanceID)
 		if err != nil {
-			return errors.Wrapf(err, "Failed to detach and delete node %s", node)
+			return errors.Wrapf(err, "Failed to check if instance is member of the ASG")
 		}
+		if !nodeInGroup {
+			logger.Infof("Attaching instance %s", instanceID)
+			_, err = p.autoscaling.AttachInstancesWithContext(ctx, &autoscaling.AttachInstancesInput{
+				AutoScalingGroupName: aws.String(autoscalingGroupName),
+				InstanceIds: []*string{
+					aws.String(instanceID),
+				},
+			})
+			if err != nil {
+				return errors.Wrapf(err, "Failed to attach instance %s", instanceID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// EnterStandby puts instances in standby in an autoscaling group.
+func (p *Provider) EnterStandby(ctx context.Context, decrement bool, instanceIDs []string, autoscalingGroupName string, logger *logrus.Entry) error {
+	inService, err := p.instancesInState(ctx, instanceIDs, autoscalingGroupName, autoscaling.LifecycleStateInService, logger)
+	if err != nil {
+		return errors.Wrap(err, "Failed to put nodes in standby")
+	}
+	if len(inService) == 0 {
+		return nil
+	}
+
+	logger.Infof("Putting instances %s in standby", strings.Join(aws.StringValueSlice(inService), ", "))
+	_, err = p.autoscaling.EnterStandbyWithContext(ctx, &autoscaling.EnterStandbyInput{
+		AutoScalingGroupName:           aws.String(autoscalingGroupName),
+		InstanceIds:                    inService,
+		ShouldDecrementDesiredCapacity: aws.Bool(decrement),
+	})
+	if err != nil {
+		return errors.Wrap(err, "Failed to put instances in standby")
+	}
+
+	return nil
+}
+
+// ExitStandby returns instances to service in an autoscaling group.
+func (p *Provider) ExitStandby(ctx context.Context, instanceIDs []string, autoscalingGroupName string, logger *logrus.Entry) error {
+	inStandby, err := p.instancesInState(ctx, instanceIDs, autoscalingGroupName, autoscaling.LifecycleStateStandby, logger)
+	if err != nil {
+		return errors.Wrap(err, "Failed to return nodes to service")
+	}
+	if len(inStandby) == 0 {
+		return nil
+	}
+
+	logger.Infof("Returning instances %s to service", strings.Join(aws.StringValueSlice(inStandby), ", "))
+	_, err = p.autoscaling.ExitStandbyWithContext(ctx, &autoscaling.ExitStandbyInput{
+		AutoScalingGroupName: aws.String(autoscalingGroupName),
+		InstanceIds:          inStandby,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Failed to return instances to service")
+	}
 
-		if instanceID == "" {
-			logger.Infof("Instance %s does not exist. No termination required", node)
-			return nil
+	return nil
+}
+
+// instancesInState returns the IDs of the instances that are in the given
+// lifecycle state in the autoscaling group.
+func (p *Provider) instancesInState(ctx context.Context, instanceIDs []string, autoscalingGroupName, lifecycleState string, logger *logrus.Entry) ([]*string, error) {
+	asg, err := p.describeAutoscalingGroup(ctx, autoscalingGroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	var inState []*string
+	for _, instanceID := range instanceIDs {
+		found := false
+		for _, instance := range asg.Instances {
+			if aws.StringValue(instance.InstanceId) != instanceID {
+				continue
+			}
+			found = true
+			if aws.StringValue(instance.LifecycleState) == lifecycleState {
+				inState = append(inState, aws.String(instanceID))
+			} else {
+				logger.Infof("Instance %s is %s, skipping", instanceID, aws.StringValue(instance.LifecycleState))
+			}
 		}
+		if !found {
+			logger.Infof("Instance %s is not a member of autoscaling group %s, skipping", instanceID, autoscalingGroupName)
+		}
+	}
 
-		logger.Infof("Terminating instance %s", instanceID)
-		sess := session.Must(session.NewSessionWithOptions(session.Options{
-			SharedConfigState: session.SharedConfigEnable,
-		}))
-		ec2Svc := ec2.New(sess)
+	return inState, nil
+}
 
-		_, err = ec2Svc.TerminateInstances(&ec2.TerminateInstancesInput{
+// isStandby returns true if the instance is in or entering standby.
+func isStandby(instance *autoscaling.Instance) bool {
+	switch aws.StringValue(instance.LifecycleState) {
+	case autoscaling.LifecycleStateStandby, autoscaling.LifecycleStateEnteringStandby:
+		return true
+	}
+
+	return false
+}
+
+// TerminateNodes terminates a slice of instances.
+func (p *Provider) TerminateNodes(ctx context.Context, instanceIDs []string, logger *logrus.Entry) error {
+	logger.Infof("Terminating %d nodes", len(instanceIDs))
+	for _, instanceID := range instanceIDs {
+		logger.Infof("Terminating instance %s", instanceID)
+		_, err := p.ec2.TerminateInstancesWithContext(ctx, &ec2.TerminateInstancesInput{
 			InstanceIds: []*string{
 				aws.String(instanceID),
 			},
 		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidInstanceID.NotFound" {
+			logger.Infof("Instance %s does not exist. No termination required", instanceID)
+			continue
+		}
 		if err != nil {
 			return errors.Wrapf(err, "Failed to delete instance %s", instanceID)
 		}
@@ -144,41 +478,92 @@ func TerminateNodes(nodesToTerminate []string, logger *logrus.Entry) error {
 	return nil
 }
 
-// GetAutoscalingGroups gets all the autoscaling groups that their names contain the cluster ID passed.
-func GetAutoscalingGroups(clusterID string) ([]*autoscaling.Group, error) {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-	svc := autoscaling.New(sess)
+// GetAutoscalingGroups gets the autoscaling groups of the cluster identified
+// by the selector, either by their names or by their cluster tags.
+func (p *Provider) GetAutoscalingGroups(ctx context.Context, selector *model.NodeGroupSelector) ([]*autoscaling.Group, error) {
+	if len(selector.Names) > 0 {
+		autoscalingGroups, err := p.describeAutoscalingGroups(ctx, &autoscaling.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: aws.StringSlice(selector.Names),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(autoscalingGroups) != len(selector.Names) {
+			return nil, errors.Errorf("found %d of the %d autoscaling groups %s", len(autoscalingGroups), len(selector.Names), strings.Join(selector.Names, ", "))
+		}
+		return autoscalingGroups, nil
+	}
+
+	// Filters are combined with AND, so each cluster tag is looked up on its own.
 	var autoscalingGroups []*autoscaling.Group
-	var nextToken *string
-	for {
-		resp, err := svc.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
-			NextToken: nextToken,
+	found := make(map[string]bool)
+	for _, tagKey := range selector.GetClusterTagKeys() {
+		key, value := selector.ClusterTag(tagKey)
+		filter := &autoscaling.Filter{
+			Name:   aws.String("tag-key"),
+			Values: []*string{aws.String(key)},
+		}
+		if value != "" {
+			filter = &autoscaling.Filter{
+				Name:   aws.String("tag:" + key),
+				Values: []*string{aws.String(value)},
+			}
+		}
+
+		asgs, err := p.describeAutoscalingGroups(ctx, &autoscaling.DescribeAutoScalingGroupsInput{
+			Filters: []*autoscaling.Filter{filter},
 		})
 		if err != nil {
-			return nil, errors.Wrap(err, "Failed to describe autoscaling groups")
+			return nil, err
 		}
-		for _, asg := range resp.AutoScalingGroups {
-			if strings.Contains(*asg.AutoScalingGroupName, clusterID) {
+		for _, asg := range asgs {
+			name := aws.StringValue(asg.AutoScalingGroupName)
+			if !found[name] {
+				found[name] = true
 				autoscalingGroups = append(autoscalingGroups, asg)
 			}
 		}
-		if resp.NextToken == nil || *resp.NextToken == "" {
-			break
-		}
-		nextToken = resp.NextToken
 	}
 
 	return autoscalingGroups, nil
 }
 
+// describeAutoscalingGroups returns all the pages of autoscaling groups described with the given input.
+func (p *Provider) describeAutoscalingGroups(ctx context.Context, input *autoscaling.DescribeAutoScalingGroupsInput) ([]*autoscaling.Group, error) {
+	var autoscalingGroups []*autoscaling.Group
+	err := p.autoscaling.DescribeAutoScalingGroupsPagesWithContext(ctx, input, func(page *autoscaling.DescribeAutoScalingGroupsOutput, lastPage bool) bool {
+		autoscalingGroups = append(autoscalingGroups, page.AutoScalingGroups...)
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to describe autoscaling groups")
+	}
+
+	return autoscalingGroups, nil
+}
+
+// asgTags returns the tags of the autoscaling group by key.
+func asgTags(asg *autoscaling.Group) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range asg.Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	return tags
+}
+
+// WaitForCapacity waits until the autoscaling group has the desired number of instances.
+func (p *Provider) WaitForCapacity(ctx context.Context, groupName string, desiredCapacity int, logger *logrus.Entry) (*model.NodeGroup, error) {
+	asg, err := p.AutoScalingGroupReady(ctx, groupName, desiredCapacity, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.nodeGroup(ctx, asg)
+}
+
 // AutoScalingGroupReady gets an AutoscalingGroup object and checks that autoscaling group is in ready state.
-func AutoScalingGroupReady(autoscalingGroupName string, desiredCapacity int, logger *logrus.Entry) (*autoscaling.Group, error) {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-	svc := autoscaling.New(sess)
+func (p *Provider) AutoScalingGroupReady(ctx context.Context, autoscalingGroupName string, desiredCapacity int, logger *logrus.Entry) (*autoscaling.Group, error) {
 	timeout := 300
 	logger.Infof("Waiting up to %d seconds for autoscaling group %s to become ready...", timeout, autoscalingGroupName)
 
@@ -187,48 +572,49 @@ func AutoScalingGroupReady(autoscalingGroupName string, desiredCapacity int, log
 
 	for {
 		select {
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "stopped waiting for autoscaling group to become ready")
 		case <-timer.C:
 			return nil, errors.New("timed out waiting for autoscaling group to become ready")
 		default:
-			resp, err := svc.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
-				AutoScalingGroupNames: []*string{
-					aws.String(autoscalingGroupName),
-				},
-			})
+			asg, err := p.describeAutoscalingGroup(ctx, autoscalingGroupName)
 			if err != nil {
-				return nil, errors.Wrapf(err, "Failed to describe the autoscaling group %s", autoscalingGroupName)
+				return nil, err
 			}
 
-			if len(resp.AutoScalingGroups[0].Instances) == desiredCapacity {
-				return resp.AutoScalingGroups[0], nil
+			if inServiceCount(asg) == desiredCapacity {
+				return asg, nil
 			}
 
 			logger.Info("AutoscalingGroup not updated with new instances, waiting...")
-			time.Sleep(5 * time.Second)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
 		}
 	}
 }
 
-func NodeInAutoscalingGroup(autoscalingGroupName, instanceID string) (bool, error) {
-	return nodeInAutoscalingGroup(autoscalingGroupName, instanceID)
+// inServiceCount returns the number of instances of the autoscaling group that are not in standby.
+func inServiceCount(asg *autoscaling.Group) int {
+	count := 0
+	for _, instance := range asg.Instances {
+		if !isStandby(instance) {
+			count++
+		}
+	}
+
+	return count
 }
 
-// nodeInAutoscalingGroup checks if an instance is member of an Autoscaling Group.
-func nodeInAutoscalingGroup(autoscalingGroupName, instanceID string) (bool, error) {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-	svc := autoscaling.New(sess)
-	resp, err := svc.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
-		AutoScalingGroupNames: []*string{
-			aws.String(autoscalingGroupName),
-		},
-	})
+// NodeInAutoscalingGroup checks if an instance is member of an Autoscaling Group.
+func (p *Provider) NodeInAutoscalingGroup(ctx context.Context, autoscalingGroupName, instanceID string) (bool, error) {
+	asg, err := p.describeAutoscalingGroup(ctx, autoscalingGroupName)
 	if err != nil {
 		return false, err
 	}
 
-	for _, instance := range resp.AutoScalingGroups[0].Instances {
+	for _, instance := range asg.Instances {
 		if *instance.InstanceId == instanceID {
 			return true, nil
 		}
@@ -236,72 +622,31 @@ func nodeInAutoscalingGroup(autoscalingGroupName, instanceID string) (bool, erro
 	return false, nil
 }
 
-func GetInstanceIDByPrivateIP(privateIP string) (string, error) {
-	// Create a new AWS session
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-
-	// Create an EC2 service client
-	ec2Svc := ec2.New(sess)
-
-	// Describe instances with the given private IP
-	input := &ec2.DescribeInstancesInput{
-		Filters: []*ec2.Filter{
-			{
-				Name:   aws.String("private-ip-address"),
-				Values: []*string{aws.String(privateIP)},
-			},
+// describeAutoscalingGroup returns the autoscaling group with the given name.
+func (p *Provider) describeAutoscalingGroup(ctx context.Context, autoscalingGroupName string) (*autoscaling.Group, error) {
+	resp, err := p.autoscaling.DescribeAutoScalingGroupsWithContext(ctx, &autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{
+			aws.String(autoscalingGroupName),
 		},
-	}
-
-	result, err := ec2Svc.DescribeInstances(input)
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to describe instances: %v", err)
+		return nil, errors.Wrapf(err, "Failed to describe the autoscaling group %s", autoscalingGroupName)
 	}
-
-	// Check if any instances were found
-	if len(result.Reservations) == 0 || len(result.Reservations[0].Instances) == 0 {
-		return "", fmt.Errorf("no instances found with the provided private IP: %s", privateIP)
+	if len(resp.AutoScalingGroups) == 0 {
+		return nil, errors.Errorf("autoscaling group %s not found", autoscalingGroupName)
 	}
 
-	// Retrieve the instance ID
-	instanceID := aws.StringValue(result.Reservations[0].Instances[0].InstanceId)
-
-	return instanceID, nil
+	return resp.AutoScalingGroups[0], nil
 }
 
-func ExtractPrivateIP(input string) (string, error) {
-	regexPattern := `ip-(\d{1,3}-\d{1,3}-\d{1,3}-\d{1,3})\.ec2\.internal`
-	regex := regexp.MustCompile(regexPattern)
-	matches := regex.FindStringSubmatch(input)
-
-	if len(matches) != 2 {
-		return "", fmt.Errorf("failed to extract private IP from input string")
+// instanceIDFromHostname returns the instance ID a hostname starts with, such
+// as i-0123456789abcdef0.us-west-2.compute.internal, or an empty string if it
+// is not named after an instance.
+func instanceIDFromHostname(hostname string) string {
+	instanceID := strings.SplitN(hostname, ".", 2)[0]
+	if !instanceIDPattern.MatchString(instanceID) {
+		return ""
 	}
 
-	privateIP := strings.ReplaceAll(matches[1], "-", ".")
-	return privateIP, nil
-}
-
-func matchesPatternPrivateDNS(input string) bool {
-	// Define the regular expression pattern
-	pattern := `^ip-\d{2,3}-\d{1,3}-\d{1,3}-\d{1,3}\.ec2\.internal$`
-
-	// Compile the regular expression
-	re := regexp.MustCompile(pattern)
-
-	// Use the MatchString method to check if the input matches the pattern
-	return re.MatchString(input)
-}
-
-func matchesPatternID(input string) bool {
-	// Define the regular expression pattern for ID pattern
-	pattern := `^i-[0-9a-f]{8,17}$`
-
-	// Compile the regular expression
-	re := regexp.MustCompile(pattern)
-
-	// Use the MatchString method to check if the input matches the pattern
-	return re.MatchString(input)
+	return instanceID
 }
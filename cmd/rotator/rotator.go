@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"os"
+	"strings"
 
 	"github.com/mattermost/rotator/model"
 	"github.com/pkg/errors"
@@ -12,28 +13,192 @@ import (
 func init() {
 	clusterCmd.PersistentFlags().String("server", "http://localhost:8079", "The Rotator server whose API will be queried.")
 
-	rotatorCmd.Flags().String("cluster", "", "the cluster ID of the cluster to go through node rotation")
-	rotatorCmd.Flags().Int("max-scaling", 1, "the max number of nodes rotating in parallel")
-	rotatorCmd.Flags().Bool("rotate-masters", false, "if disabled, master nodes will not be rotated")
-	rotatorCmd.Flags().Bool("rotate-workers", false, "if disabled, worker nodes will not be rotated")
-	rotatorCmd.Flags().Int("max-drain-retries", 10, "the max number of retries when drain fails")
-	rotatorCmd.Flags().Int("evict-grace-period", 60, "the pod eviction grace period")
-	rotatorCmd.Flags().Int("wait-between-rotations", 60, "the time in seconds between each node rotation")
-	rotatorCmd.Flags().Int("wait-between-drains", 60, "the time in seconds between each node drain")
-	rotatorCmd.Flags().Int("wait-between-pod-evictions", 0, "the time in seconds between each pod eviction in a drain")
+	addRotateFlags(rotatorCmd)
+	rotatorCmd.Flags().Bool("dry-run", false, "if enabled, only print the rotation plan without rotating any node")
 
 	drainCmd.Flags().String("node", "", "the name of the node to do drain operations")
 	drainCmd.Flags().Int("evict-grace-period", 60, "the pod eviction grace period")
 	drainCmd.Flags().Int("wait-between-pod-evictions", 2, "the time in seconds between each pod eviction in a drain")
 	drainCmd.Flags().Int("max-drain-retries", 10, "the max number of retries when drain fails")
 	drainCmd.Flags().Bool("detach", false, "whether to detach the node from its autoscaling group")
+	drainCmd.Flags().Bool("standby", false, "whether to put the node in standby in its autoscaling group, returning it to service if the drain fails")
 	drainCmd.Flags().Bool("terminate", false, "whether to terminate the node")
 	drainCmd.Flags().String("cluster", "", "the cluster ID of the cluster to that the node will be drained. Needed when detach is required")
+	drainCmd.Flags().StringSlice("cluster-tag-keys", nil, "the keys of the tags identifying the ASGs of the cluster, with {clusterID} standing for the cluster ID in keys naming it (defaults to KubernetesCluster,kubernetes.io/cluster/{clusterID})")
+	addPodEvictionFlags(drainCmd)
 
 	drainCmd.MarkFlagRequired("node") //nolint
 
+	statusCmd.Flags().String("rotation", "", "the ID of the cluster rotation job to get the status of")
+	statusCmd.Flags().String("drain", "", "the ID of the node drain job to get the status of")
+
+	cancelCmd.Flags().String("rotation", "", "the ID of the cluster rotation job to cancel")
+	cancelCmd.Flags().String("drain", "", "the ID of the node drain job to cancel")
+
+	pauseCmd.Flags().String("rotation", "", "the ID of the cluster rotation job to pause")
+	pauseCmd.MarkFlagRequired("rotation") //nolint
+
+	resumeCmd.Flags().String("rotation", "", "the ID of the paused or cancelled cluster rotation job to resume")
+	resumeCmd.MarkFlagRequired("rotation") //nolint
+
 	clusterCmd.AddCommand(rotatorCmd)
 	clusterCmd.AddCommand(drainCmd)
+	clusterCmd.AddCommand(statusCmd)
+	clusterCmd.AddCommand(cancelCmd)
+	clusterCmd.AddCommand(pauseCmd)
+	clusterCmd.AddCommand(resumeCmd)
+	clusterCmd.AddCommand(scheduleCmd)
+}
+
+// addRotateFlags adds the flags describing a cluster rotation to the given command.
+func addRotateFlags(command *cobra.Command) {
+	command.Flags().String("cluster", "", "the cluster ID of the cluster to go through node rotation")
+	command.Flags().Int("max-scaling", 1, "the max number of nodes rotating in parallel")
+	command.Flags().Bool("rotate-masters", false, "if disabled, master nodes will not be rotated")
+	command.Flags().Bool("rotate-workers", false, "if disabled, worker nodes will not be rotated")
+	command.Flags().Int("max-drain-retries", 10, "the max number of retries when drain fails")
+	command.Flags().Int("evict-grace-period", 60, "the pod eviction grace period")
+	command.Flags().Int("wait-between-rotations", 60, "the time in seconds between each node rotation")
+	command.Flags().Int("wait-between-drains", 60, "the time in seconds between each node drain")
+	command.Flags().Int("wait-between-pod-evictions", 0, "the time in seconds between each pod eviction in a drain")
+	command.Flags().Bool("drift-only", false, "if enabled, only nodes launched from an outdated launch template or configuration will be rotated")
+	command.Flags().Bool("drift-compare-image", false, "if enabled with drift-only, nodes running an outdated AMI will also be rotated")
+	command.Flags().Bool("drift-compare-type", false, "if enabled with drift-only, nodes of an outdated instance type will also be rotated")
+	command.Flags().Duration("max-age", 0, "if set, only nodes older than this age will be rotated, oldest first (e.g. 720h)")
+	command.Flags().String("strategy", model.RotationStrategyDetach, "how worker nodes are replaced: detach them and let the ASG replace them, or surge the ASG before draining them")
+	command.Flags().Bool("standby", false, "if enabled, worker nodes are put in standby instead of detached, and returned to service if their replacements fail")
+	command.Flags().String("failure-policy", "", "what to do when a batch of worker nodes fails to rotate: abort, rollback or continue (defaults to rollback with standby, abort otherwise)")
+	command.Flags().StringSlice("autoscaling-groups", nil, "the names of the ASGs of the cluster, overriding their discovery by tags")
+	command.Flags().StringSlice("cluster-tag-keys", nil, "the keys of the tags identifying the ASGs of the cluster, with {clusterID} standing for the cluster ID in keys naming it (defaults to KubernetesCluster,kubernetes.io/cluster/{clusterID})")
+	command.Flags().String("master-tag-key", "", "the key of the tag marking the ASGs of masters (defaults to k8s.io/role/master or k8s.io/role/control-plane)")
+	command.Flags().StringSlice("include-autoscaling-groups", nil, "if set, only the nodes of these ASGs will be rotated")
+	command.Flags().StringSlice("exclude-autoscaling-groups", nil, "the ASGs whose nodes will not be rotated")
+	command.Flags().StringSlice("nodes", nil, "if set, only these nodes will be rotated")
+	command.Flags().Int("parallel-groups", 1, "the max number of worker ASGs rotating in parallel, masters are always rotated one ASG at a time")
+	command.Flags().Int("max-draining-nodes", 0, "the max number of nodes draining at once across the ASGs rotating in parallel, 0 for no limit")
+	command.Flags().Bool("suspend-az-rebalance", false, "if enabled, the AZRebalance process of ASGs is suspended while they are rotated")
+	command.Flags().StringSlice("suspend-processes", nil, "the processes of ASGs suspended while they are rotated: AZRebalance, ReplaceUnhealthy or ScheduledActions")
+	command.Flags().String("pdb-policy", "", "what to do with a batch of nodes whose pods PodDisruptionBudgets do not allow to evict: ignore, wait or refuse (defaults to ignore)")
+	command.Flags().Duration("pdb-wait-timeout", 0, "how long a batch of nodes is delayed at most by PodDisruptionBudgets with the wait policy (defaults to 10m)")
+	command.Flags().Bool("disable-scale-down", false, "if enabled, nodes are annotated so that cluster-autoscaler does not scale them down while they are rotated")
+	addPodEvictionFlags(command)
+	command.Flags().String("label-selector", "", "if set, only nodes matching this label selector will be rotated (e.g. kops.k8s.io/instancegroup=nodes-large)")
+}
+
+// addPodEvictionFlags adds the flags setting how the pods of a node are evicted.
+func addPodEvictionFlags(command *cobra.Command) {
+	command.Flags().Bool("evict-by-priority", false, "if enabled, pods of lower priority are evicted and deleted before pods of higher priority")
+	command.Flags().StringArray("eviction-namespace-tier", nil, "comma-separated namespaces whose pods are evicted after those of the tiers given before, repeat for every tier (pods of other namespaces are evicted first)")
+	command.Flags().Duration("completion-timeout", 0, "how long pods annotated with rotator.mattermost.com/wait-for-completion are waited for (defaults to 30m)")
+	command.Flags().String("completion-policy", "", "what to do with pods waited for that do not complete in time: fail the drain or evict them (defaults to fail)")
+	command.Flags().Int("max-concurrent-evictions", 0, "how many pods of a node are evicted at once (defaults to 10)")
+}
+
+// completionTimeoutFromFlags returns the completion timeout set with addPodEvictionFlags, if any.
+func completionTimeoutFromFlags(command *cobra.Command) string {
+	completionTimeout, _ := command.Flags().GetDuration("completion-timeout")
+	if completionTimeout <= 0 {
+		return ""
+	}
+
+	return completionTimeout.String()
+}
+
+// evictionNamespaceTiersFromFlags returns the namespace tiers set with addPodEvictionFlags.
+func evictionNamespaceTiersFromFlags(command *cobra.Command) [][]string {
+	tierFlags, _ := command.Flags().GetStringArray("eviction-namespace-tier")
+
+	var tiers [][]string
+	for _, tierFlag := range tierFlags {
+		var tier []string
+		for _, namespace := range strings.Split(tierFlag, ",") {
+			tier = append(tier, strings.TrimSpace(namespace))
+		}
+		tiers = append(tiers, tier)
+	}
+
+	return tiers
+}
+
+// rotateClusterRequestFromFlags builds a cluster rotation request from the flags added by addRotateFlags.
+func rotateClusterRequestFromFlags(command *cobra.Command) *model.RotateClusterRequest {
+	clusterID, _ := command.Flags().GetString("cluster")
+	maxScaling, _ := command.Flags().GetInt("max-scaling")
+	rotateMasters, _ := command.Flags().GetBool("rotate-masters")
+	rotateWorkers, _ := command.Flags().GetBool("rotate-workers")
+	maxDrainRetries, _ := command.Flags().GetInt("max-drain-retries")
+	evictGracePeriod, _ := command.Flags().GetInt("evict-grace-period")
+	waitBetweenRotations, _ := command.Flags().GetInt("wait-between-rotations")
+	waitBetweenDrains, _ := command.Flags().GetInt("wait-between-drains")
+	waitBetweenPodEvictions, _ := command.Flags().GetInt("wait-between-pod-evictions")
+	driftOnly, _ := command.Flags().GetBool("drift-only")
+	driftCompareImage, _ := command.Flags().GetBool("drift-compare-image")
+	driftCompareType, _ := command.Flags().GetBool("drift-compare-type")
+	maxAge, _ := command.Flags().GetDuration("max-age")
+	strategy, _ := command.Flags().GetString("strategy")
+	standby, _ := command.Flags().GetBool("standby")
+	failurePolicy, _ := command.Flags().GetString("failure-policy")
+	autoscalingGroups, _ := command.Flags().GetStringSlice("autoscaling-groups")
+	clusterTagKeys, _ := command.Flags().GetStringSlice("cluster-tag-keys")
+	masterTagKey, _ := command.Flags().GetString("master-tag-key")
+	includeAutoscalingGroups, _ := command.Flags().GetStringSlice("include-autoscaling-groups")
+	excludeAutoscalingGroups, _ := command.Flags().GetStringSlice("exclude-autoscaling-groups")
+	nodes, _ := command.Flags().GetStringSlice("nodes")
+	labelSelector, _ := command.Flags().GetString("label-selector")
+	parallelGroups, _ := command.Flags().GetInt("parallel-groups")
+	maxDrainingNodes, _ := command.Flags().GetInt("max-draining-nodes")
+	suspendAZRebalance, _ := command.Flags().GetBool("suspend-az-rebalance")
+	suspendProcesses, _ := command.Flags().GetStringSlice("suspend-processes")
+	disableScaleDown, _ := command.Flags().GetBool("disable-scale-down")
+	pdbPolicy, _ := command.Flags().GetString("pdb-policy")
+	pdbWaitTimeout, _ := command.Flags().GetDuration("pdb-wait-timeout")
+	evictByPriority, _ := command.Flags().GetBool("evict-by-priority")
+	completionPolicy, _ := command.Flags().GetString("completion-policy")
+	maxConcurrentEvictions, _ := command.Flags().GetInt("max-concurrent-evictions")
+
+	request := &model.RotateClusterRequest{
+		ClusterID:                clusterID,
+		MaxScaling:               maxScaling,
+		RotateMasters:            rotateMasters,
+		RotateWorkers:            rotateWorkers,
+		MaxDrainRetries:          maxDrainRetries,
+		EvictGracePeriod:         evictGracePeriod,
+		WaitBetweenRotations:     waitBetweenRotations,
+		WaitBetweenDrains:        waitBetweenDrains,
+		WaitBetweenPodEvictions:  waitBetweenPodEvictions,
+		DriftOnly:                driftOnly,
+		DriftCompareImage:        driftCompareImage,
+		DriftCompareType:         driftCompareType,
+		Strategy:                 strategy,
+		Standby:                  standby,
+		FailurePolicy:            failurePolicy,
+		AutoscalingGroups:        autoscalingGroups,
+		ClusterTagKeys:           clusterTagKeys,
+		MasterTagKey:             masterTagKey,
+		IncludeAutoscalingGroups: includeAutoscalingGroups,
+		ExcludeAutoscalingGroups: excludeAutoscalingGroups,
+		Nodes:                    nodes,
+		LabelSelector:            labelSelector,
+		ParallelGroups:           parallelGroups,
+		MaxDrainingNodes:         maxDrainingNodes,
+		SuspendAZRebalance:       suspendAZRebalance,
+		SuspendProcesses:         suspendProcesses,
+		DisableScaleDown:         disableScaleDown,
+		PDBPolicy:                pdbPolicy,
+		EvictByPriority:          evictByPriority,
+		EvictionNamespaceTiers:   evictionNamespaceTiersFromFlags(command),
+		CompletionTimeout:        completionTimeoutFromFlags(command),
+		CompletionPolicy:         completionPolicy,
+		MaxConcurrentEvictions:   maxConcurrentEvictions,
+	}
+	if maxAge > 0 {
+		request.MaxNodeAge = maxAge.String()
+	}
+	if pdbWaitTimeout > 0 {
+		request.PDBWaitTimeout = pdbWaitTimeout.String()
+	}
+
+	return request
 }
 
 var clusterCmd = &cobra.Command{
@@ -55,8 +220,13 @@ var drainCmd = &cobra.Command{
 		waitBetweenPodEvictions, _ := command.Flags().GetInt("wait-between-pod-evictions")
 		maxDrainRetries, _ := command.Flags().GetInt("max-drain-retries")
 		detachNode, _ := command.Flags().GetBool("detach")
+		standbyNode, _ := command.Flags().GetBool("standby")
 		terminateNode, _ := command.Flags().GetBool("terminate")
 		clusterID, _ := command.Flags().GetString("cluster")
+		clusterTagKeys, _ := command.Flags().GetStringSlice("cluster-tag-keys")
+		evictByPriority, _ := command.Flags().GetBool("evict-by-priority")
+		completionPolicy, _ := command.Flags().GetString("completion-policy")
+		maxConcurrentEvictions, _ := command.Flags().GetInt("max-concurrent-evictions")
 
 		drain, err := client.DrainNode(&model.DrainNodeRequest{
 			NodeName:                nodeName,
@@ -64,8 +234,15 @@ var drainCmd = &cobra.Command{
 			WaitBetweenPodEvictions: waitBetweenPodEvictions,
 			MaxDrainRetries:         maxDrainRetries,
 			DetachNode:              detachNode,
+			StandbyNode:             standbyNode,
 			TerminateNode:           terminateNode,
 			ClusterID:               clusterID,
+			ClusterTagKeys:          clusterTagKeys,
+			EvictByPriority:         evictByPriority,
+			EvictionNamespaceTiers:  evictionNamespaceTiersFromFlags(command),
+			CompletionTimeout:       completionTimeoutFromFlags(command),
+			CompletionPolicy:        completionPolicy,
+			MaxConcurrentEvictions:  maxConcurrentEvictions,
 		})
 		if err != nil {
 			return errors.Wrap(err, "failed to drain node")
@@ -87,27 +264,18 @@ var rotatorCmd = &cobra.Command{
 		serverAddress, _ := command.Flags().GetString("server")
 		client := model.NewClient(serverAddress)
 
-		clusterID, _ := command.Flags().GetString("cluster")
-		maxScaling, _ := command.Flags().GetInt("max-scaling")
-		rotateMasters, _ := command.Flags().GetBool("rotate-masters")
-		rotateWorkers, _ := command.Flags().GetBool("rotate-workers")
-		maxDrainRetries, _ := command.Flags().GetInt("max-drain-retries")
-		evictGracePeriod, _ := command.Flags().GetInt("evict-grace-period")
-		waitBetweenRotations, _ := command.Flags().GetInt("wait-between-rotations")
-		waitBetweenDrains, _ := command.Flags().GetInt("wait-between-drains")
-		waitBetweenPodEvictions, _ := command.Flags().GetInt("wait-between-pod-evictions")
+		request := rotateClusterRequestFromFlags(command)
+		dryRun, _ := command.Flags().GetBool("dry-run")
 
-		rotator, err := client.RotateCluster(&model.RotateClusterRequest{
-			ClusterID:               clusterID,
-			MaxScaling:              maxScaling,
-			RotateMasters:           rotateMasters,
-			RotateWorkers:           rotateWorkers,
-			MaxDrainRetries:         maxDrainRetries,
-			EvictGracePeriod:        evictGracePeriod,
-			WaitBetweenRotations:    waitBetweenRotations,
-			WaitBetweenDrains:       waitBetweenDrains,
-			WaitBetweenPodEvictions: waitBetweenPodEvictions,
-		})
+		if dryRun {
+			plan, err := client.PlanClusterRotation(request)
+			if err != nil {
+				return errors.Wrap(err, "failed to plan the rotation of the k8s cluster")
+			}
+			return printJSON(plan)
+		}
+
+		rotator, err := client.RotateCluster(request)
 		if err != nil {
 			return errors.Wrap(err, "failed to rotate nodes of the k8s cluster")
 		}
@@ -120,6 +288,109 @@ var rotatorCmd = &cobra.Command{
 	},
 }
 
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Get the status of a cluster rotation or node drain job.",
+	RunE: func(command *cobra.Command, args []string) error {
+		command.SilenceUsage = true
+		serverAddress, _ := command.Flags().GetString("server")
+		client := model.NewClient(serverAddress)
+
+		rotationID, _ := command.Flags().GetString("rotation")
+		drainID, _ := command.Flags().GetString("drain")
+
+		var job *model.Job
+		var err error
+		switch {
+		case rotationID != "" && drainID != "":
+			return errors.New("only one of --rotation and --drain can be set")
+		case rotationID != "":
+			job, err = client.GetRotation(rotationID)
+		case drainID != "":
+			job, err = client.GetDrain(drainID)
+		default:
+			return errors.New("one of --rotation or --drain must be set")
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to get job")
+		}
+		if job == nil {
+			return errors.New("job not found")
+		}
+
+		return printJSON(job)
+	},
+}
+
+var cancelCmd = &cobra.Command{
+	Use:   "cancel",
+	Short: "Cancel a running cluster rotation or node drain job.",
+	RunE: func(command *cobra.Command, args []string) error {
+		command.SilenceUsage = true
+		serverAddress, _ := command.Flags().GetString("server")
+		client := model.NewClient(serverAddress)
+
+		rotationID, _ := command.Flags().GetString("rotation")
+		drainID, _ := command.Flags().GetString("drain")
+
+		var job *model.Job
+		var err error
+		switch {
+		case rotationID != "" && drainID != "":
+			return errors.New("only one of --rotation and --drain can be set")
+		case rotationID != "":
+			job, err = client.CancelRotation(rotationID)
+		case drainID != "":
+			job, err = client.CancelDrain(drainID)
+		default:
+			return errors.New("one of --rotation or --drain must be set")
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to cancel job")
+		}
+
+		return printJSON(job)
+	},
+}
+
+var pauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause a cluster rotation job once its current batch of nodes is rotated.",
+	RunE: func(command *cobra.Command, args []string) error {
+		command.SilenceUsage = true
+		serverAddress, _ := command.Flags().GetString("server")
+		client := model.NewClient(serverAddress)
+
+		rotationID, _ := command.Flags().GetString("rotation")
+
+		job, err := client.PauseRotation(rotationID)
+		if err != nil {
+			return errors.Wrap(err, "failed to pause rotation")
+		}
+
+		return printJSON(job)
+	},
+}
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume a paused or cancelled cluster rotation job.",
+	RunE: func(command *cobra.Command, args []string) error {
+		command.SilenceUsage = true
+		serverAddress, _ := command.Flags().GetString("server")
+		client := model.NewClient(serverAddress)
+
+		rotationID, _ := command.Flags().GetString("rotation")
+
+		job, err := client.ResumeRotation(rotationID)
+		if err != nil {
+			return errors.Wrap(err, "failed to resume rotation")
+		}
+
+		return printJSON(job)
+	},
+}
+
 func printJSON(data interface{}) error {
 	encoder := json.NewEncoder(os.Stdout)
 	encoder.SetIndent("", "    ")
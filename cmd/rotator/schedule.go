@@ -0,0 +1,147 @@
+package main
+
+import (
+	"github.com/mattermost/rotator/model"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addRotateFlags(scheduleCreateCmd)
+	scheduleCreateCmd.Flags().String("cron", "", "the standard cron expression of when the rotation is due (e.g. \"0 3 * * 2\")")
+	scheduleCreateCmd.Flags().String("window", "", "the maintenance window outside of which the rotation is paused (e.g. \"Tue-Thu 02:00-05:00 UTC\")")
+	scheduleCreateCmd.MarkFlagRequired("cron") //nolint
+
+	addRotateFlags(scheduleUpdateCmd)
+	scheduleUpdateCmd.Flags().String("schedule", "", "the ID of the schedule to update")
+	scheduleUpdateCmd.Flags().String("cron", "", "the standard cron expression of when the rotation is due (e.g. \"0 3 * * 2\")")
+	scheduleUpdateCmd.Flags().String("window", "", "the maintenance window outside of which the rotation is paused (e.g. \"Tue-Thu 02:00-05:00 UTC\")")
+	scheduleUpdateCmd.MarkFlagRequired("schedule") //nolint
+	scheduleUpdateCmd.MarkFlagRequired("cron")     //nolint
+
+	scheduleGetCmd.Flags().String("schedule", "", "the ID of the schedule to get")
+	scheduleGetCmd.MarkFlagRequired("schedule") //nolint
+
+	scheduleDeleteCmd.Flags().String("schedule", "", "the ID of the schedule to delete")
+	scheduleDeleteCmd.MarkFlagRequired("schedule") //nolint
+
+	scheduleCmd.AddCommand(scheduleCreateCmd)
+	scheduleCmd.AddCommand(scheduleUpdateCmd)
+	scheduleCmd.AddCommand(scheduleListCmd)
+	scheduleCmd.AddCommand(scheduleGetCmd)
+	scheduleCmd.AddCommand(scheduleDeleteCmd)
+}
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Manage scheduled cluster rotations.",
+}
+
+var scheduleCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Schedule the periodic rotation of a k8s cluster.",
+	RunE: func(command *cobra.Command, args []string) error {
+		command.SilenceUsage = true
+		serverAddress, _ := command.Flags().GetString("server")
+		client := model.NewClient(serverAddress)
+
+		schedule, err := client.CreateSchedule(scheduleRequestFromFlags(command))
+		if err != nil {
+			return errors.Wrap(err, "failed to create schedule")
+		}
+
+		return printJSON(schedule)
+	},
+}
+
+var scheduleUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Replace the parameters of a scheduled cluster rotation.",
+	RunE: func(command *cobra.Command, args []string) error {
+		command.SilenceUsage = true
+		serverAddress, _ := command.Flags().GetString("server")
+		client := model.NewClient(serverAddress)
+
+		scheduleID, _ := command.Flags().GetString("schedule")
+
+		schedule, err := client.UpdateSchedule(scheduleID, scheduleRequestFromFlags(command))
+		if err != nil {
+			return errors.Wrap(err, "failed to update schedule")
+		}
+		if schedule == nil {
+			return errors.New("schedule not found")
+		}
+
+		return printJSON(schedule)
+	},
+}
+
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the scheduled cluster rotations.",
+	RunE: func(command *cobra.Command, args []string) error {
+		command.SilenceUsage = true
+		serverAddress, _ := command.Flags().GetString("server")
+		client := model.NewClient(serverAddress)
+
+		schedules, err := client.GetSchedules()
+		if err != nil {
+			return errors.Wrap(err, "failed to list schedules")
+		}
+
+		return printJSON(schedules)
+	},
+}
+
+var scheduleGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get a scheduled cluster rotation.",
+	RunE: func(command *cobra.Command, args []string) error {
+		command.SilenceUsage = true
+		serverAddress, _ := command.Flags().GetString("server")
+		client := model.NewClient(serverAddress)
+
+		scheduleID, _ := command.Flags().GetString("schedule")
+
+		schedule, err := client.GetSchedule(scheduleID)
+		if err != nil {
+			return errors.Wrap(err, "failed to get schedule")
+		}
+		if schedule == nil {
+			return errors.New("schedule not found")
+		}
+
+		return printJSON(schedule)
+	},
+}
+
+var scheduleDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete a scheduled cluster rotation. Rotations it already launched keep running.",
+	RunE: func(command *cobra.Command, args []string) error {
+		command.SilenceUsage = true
+		serverAddress, _ := command.Flags().GetString("server")
+		client := model.NewClient(serverAddress)
+
+		scheduleID, _ := command.Flags().GetString("schedule")
+
+		err := client.DeleteSchedule(scheduleID)
+		if err != nil {
+			return errors.Wrap(err, "failed to delete schedule")
+		}
+
+		return nil
+	},
+}
+
+// scheduleRequestFromFlags builds a schedule request from the flags of the given command.
+func scheduleRequestFromFlags(command *cobra.Command) *model.ScheduleRequest {
+	cron, _ := command.Flags().GetString("cron")
+	window, _ := command.Flags().GetString("window")
+
+	return &model.ScheduleRequest{
+		Cron:     cron,
+		Window:   window,
+		Rotation: *rotateClusterRequestFromFlags(command),
+	}
+}
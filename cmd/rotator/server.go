@@ -2,14 +2,18 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/mattermost/rotator/api"
+	"github.com/mattermost/rotator/jobs"
+	"github.com/mattermost/rotator/k8s"
 	"github.com/mattermost/rotator/model"
 	"github.com/sirupsen/logrus"
 
@@ -29,6 +33,8 @@ func init() {
 
 	serverCmd.PersistentFlags().String("listen", ":8079", "The interface and port on which to listen.")
 	serverCmd.PersistentFlags().Bool("debug", false, "Whether to output debug logs.")
+	serverCmd.PersistentFlags().String("lock-namespace", "", "If set, cluster locks are kept as Kubernetes Leases in this namespace, so that they are shared by all rotator servers using the same Kubernetes cluster.")
+	serverCmd.PersistentFlags().String("store-dir", filepath.Join(os.Getenv("HOME"), ".rotator", "jobs"), "The directory where jobs and schedules are persisted so that they can be resumed after a restart. If empty, they are only kept in memory.")
 }
 
 func serverCmdF(command *cobra.Command, args []string) error {
@@ -42,10 +48,50 @@ func serverCmdF(command *cobra.Command, args []string) error {
 	logger := logger.WithField("instance", instanceID)
 	logger.Info("Starting Mattermost Rotator Server")
 
+	var store jobs.Store
+	var scheduleStore jobs.ScheduleStore
+	storeDir, _ := command.Flags().GetString("store-dir")
+	if storeDir != "" {
+		fileStore, err := jobs.NewFileStore(storeDir)
+		if err != nil {
+			return err
+		}
+		store = fileStore
+		scheduleStore = fileStore
+		logger.WithField("dir", storeDir).Info("Persisting jobs and schedules")
+	}
+
+	var locker jobs.Locker
+	lockNamespace, _ := command.Flags().GetString("lock-namespace")
+	if lockNamespace != "" {
+		clientset, err := k8s.GetClientset()
+		if err != nil {
+			return err
+		}
+		locker = jobs.NewLeaseLocker(clientset, lockNamespace, logger)
+		logger.WithField("namespace", lockNamespace).Info("Locking clusters with Kubernetes Leases")
+	}
+
+	jobRegistry := jobs.NewRegistry(store, locker, logger)
+	err := jobRegistry.Restore()
+	if err != nil {
+		return err
+	}
+
+	scheduler := jobs.NewScheduler(jobRegistry, scheduleStore, logger)
+	err = scheduler.Start()
+	if err != nil {
+		return err
+	}
+	defer scheduler.Stop()
+
 	router := mux.NewRouter()
+	router.Handle("/debug/vars", expvar.Handler())
 
 	api.Register(router, &api.Context{
-		Logger: logger,
+		Jobs:      jobRegistry,
+		Schedules: scheduler,
+		Logger:    logger,
 	})
 
 	listen, _ := command.Flags().GetString("listen")
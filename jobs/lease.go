@@ -0,0 +1,266 @@
+package jobs
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	leaseDuration       = 60 * time.Second
+	leaseClusterIDKey   = "rotator.mattermost.com/cluster-id"
+	leaseLockAttempts   = 3
+	leaseRequestTimeout = 30 * time.Second
+)
+
+var invalidLeaseNameChars = regexp.MustCompile(`[^a-z0-9.-]`)
+
+// errLeaseLost is returned when renewing a lease that another job acquired.
+var errLeaseLost = errors.New("lease lost")
+
+// LeaseLocker is a Locker backed by Kubernetes coordination.k8s.io Leases,
+// allowing several rotator servers to share the same cluster locks. A lease
+// is renewed for as long as it is held, so the lock of a server that stops
+// expires after the lease duration. A lease that cannot be renewed before it
+// expires is reported as lost.
+type LeaseLocker struct {
+	clientset kubernetes.Interface
+	namespace string
+	logger    logrus.FieldLogger
+
+	mu       sync.Mutex
+	renewals map[string]chan struct{}
+	onLost   func(clusterID, jobID string, err error)
+}
+
+// NewLeaseLocker creates a cluster locker keeping its leases in the given namespace.
+func NewLeaseLocker(clientset kubernetes.Interface, namespace string, logger logrus.FieldLogger) *LeaseLocker {
+	return &LeaseLocker{
+		clientset: clientset,
+		namespace: namespace,
+		logger:    logger,
+		renewals:  make(map[string]chan struct{}),
+	}
+}
+
+// Lock acquires the lease of the cluster for the given job.
+func (l *LeaseLocker) Lock(clusterID, jobID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), leaseRequestTimeout)
+	defer cancel()
+
+	leases := l.clientset.CoordinationV1().Leases(l.namespace)
+	name := leaseName(clusterID)
+
+	// Creating or updating the lease races with other servers, so retry a
+	// few times before giving up.
+	for attempt := 0; attempt < leaseLockAttempts; attempt++ {
+		now := metav1.NewMicroTime(time.Now())
+		durationSeconds := int32(leaseDuration.Seconds())
+
+		lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			_, err = leases.Create(ctx, &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Annotations: map[string]string{leaseClusterIDKey: clusterID},
+				},
+				Spec: coordinationv1.LeaseSpec{
+					HolderIdentity:       &jobID,
+					LeaseDurationSeconds: &durationSeconds,
+					AcquireTime:          &now,
+					RenewTime:            &now,
+				},
+			}, metav1.CreateOptions{})
+			if k8sErrors.IsAlreadyExists(err) {
+				continue
+			}
+			if err != nil {
+				return "", errors.Wrapf(err, "failed to create lease %s", name)
+			}
+			l.startRenewal(clusterID, jobID)
+			return jobID, nil
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to get lease %s", name)
+		}
+
+		holder := ""
+		if lease.Spec.HolderIdentity != nil {
+			holder = *lease.Spec.HolderIdentity
+		}
+		if holder != "" && holder != jobID && !leaseExpired(lease) {
+			return holder, nil
+		}
+
+		if holder != jobID {
+			lease.Spec.AcquireTime = &now
+		}
+		lease.Spec.HolderIdentity = &jobID
+		lease.Spec.LeaseDurationSeconds = &durationSeconds
+		lease.Spec.RenewTime = &now
+		_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+		if k8sErrors.IsConflict(err) {
+			continue
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to update lease %s", name)
+		}
+		l.startRenewal(clusterID, jobID)
+		return jobID, nil
+	}
+
+	return "", errors.Errorf("failed to acquire lease %s after %d attempts", name, leaseLockAttempts)
+}
+
+// Unlock releases the lease of the cluster if it is held by the given job.
+func (l *LeaseLocker) Unlock(clusterID, jobID string) error {
+	l.stopRenewal(clusterID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), leaseRequestTimeout)
+	defer cancel()
+
+	leases := l.clientset.CoordinationV1().Leases(l.namespace)
+	name := leaseName(clusterID)
+
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to get lease %s", name)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != jobID {
+		return nil
+	}
+
+	err = leases.Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete lease %s", name)
+	}
+
+	return nil
+}
+
+// NotifyLost sets the function called when a lease cannot be kept.
+func (l *LeaseLocker) NotifyLost(onLost func(clusterID, jobID string, err error)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.onLost = onLost
+}
+
+func (l *LeaseLocker) startRenewal(clusterID, jobID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.renewals[clusterID]; ok {
+		return
+	}
+	stop := make(chan struct{})
+	l.renewals[clusterID] = stop
+
+	go func() {
+		interval := leaseDuration / 3
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		renewed := time.Now()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				err := l.renew(clusterID, jobID)
+				if err == nil {
+					renewed = time.Now()
+					continue
+				}
+				l.logger.WithError(err).WithField("cluster", clusterID).Error("Failed to renew cluster lease")
+
+				// The lease is kept through failed renewals as long as it
+				// does not expire before the next attempt.
+				if errors.Is(err, errLeaseLost) || time.Since(renewed)+interval >= leaseDuration {
+					l.lost(clusterID, jobID, err)
+					return
+				}
+			}
+		}
+	}()
+}
+
+// lost reports that the lease of the cluster held by the job cannot be kept.
+func (l *LeaseLocker) lost(clusterID, jobID string, err error) {
+	l.mu.Lock()
+	onLost := l.onLost
+	l.mu.Unlock()
+
+	if onLost != nil {
+		onLost(clusterID, jobID, err)
+	}
+}
+
+func (l *LeaseLocker) stopRenewal(clusterID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if stop, ok := l.renewals[clusterID]; ok {
+		close(stop)
+		delete(l.renewals, clusterID)
+	}
+}
+
+func (l *LeaseLocker) renew(clusterID, jobID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), leaseRequestTimeout)
+	defer cancel()
+
+	leases := l.clientset.CoordinationV1().Leases(l.namespace)
+	name := leaseName(clusterID)
+
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get lease %s", name)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != jobID {
+		return errors.Wrapf(errLeaseLost, "lease %s is no longer held by job %s", name, jobID)
+	}
+
+	now := metav1.NewMicroTime(time.Now())
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to update lease %s", name)
+	}
+
+	return nil
+}
+
+// leaseExpired returns true if the holder of the lease stopped renewing it.
+func leaseExpired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+
+	return time.Now().After(expiry)
+}
+
+// leaseName returns a valid Kubernetes object name for the lease of a cluster.
+func leaseName(clusterID string) string {
+	name := "rotator-" + invalidLeaseNameChars.ReplaceAllString(strings.ToLower(clusterID), "-")
+	if len(name) > 253 {
+		name = name[:253]
+	}
+
+	return strings.TrimRight(name, ".-")
+}
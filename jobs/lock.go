@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"sync"
+)
+
+// Locker grants jobs exclusive access to a cluster, so that only one job
+// detaches, drains and terminates the nodes of a cluster at a time.
+type Locker interface {
+	// Lock acquires the lock of the cluster for the given job and returns the
+	// ID of the job holding the lock. If the returned ID differs from jobID,
+	// the cluster is locked by another job. Locking a cluster the job already
+	// holds succeeds.
+	Lock(clusterID, jobID string) (string, error)
+	// Unlock releases the lock of the cluster if it is held by the given job.
+	Unlock(clusterID, jobID string) error
+}
+
+// LostLockNotifier is implemented by Lockers whose locks can be lost while
+// held, such as locks backed by expiring leases.
+type LostLockNotifier interface {
+	// NotifyLost sets the function called when a job loses the lock of a
+	// cluster it held.
+	NotifyLost(onLost func(clusterID, jobID string, err error))
+}
+
+// MemoryLocker is a Locker for a single rotator server.
+type MemoryLocker struct {
+	mu    sync.Mutex
+	locks map[string]string
+}
+
+// NewMemoryLocker creates a new in-memory cluster locker.
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{
+		locks: make(map[string]string),
+	}
+}
+
+// Lock acquires the lock of the cluster for the given job.
+func (l *MemoryLocker) Lock(clusterID, jobID string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if owner, ok := l.locks[clusterID]; ok {
+		return owner, nil
+	}
+	l.locks[clusterID] = jobID
+
+	return jobID, nil
+}
+
+// Unlock releases the lock of the cluster if it is held by the given job.
+func (l *MemoryLocker) Unlock(clusterID, jobID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.locks[clusterID] == jobID {
+		delete(l.locks, clusterID)
+	}
+
+	return nil
+}
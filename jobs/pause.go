@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+)
+
+// pauseGate holds a rotation at its next node boundary for as long as it is paused.
+type pauseGate struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{}
+}
+
+func newPauseGate(paused bool) *pauseGate {
+	gate := &pauseGate{}
+	if paused {
+		gate.pause()
+	}
+
+	return gate
+}
+
+// pause makes the next call to wait block until resume is called.
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.paused {
+		g.paused = true
+		g.resumed = make(chan struct{})
+	}
+}
+
+// resume releases any rotation held by the gate.
+func (g *pauseGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.paused {
+		g.paused = false
+		close(g.resumed)
+	}
+}
+
+// isPaused returns true if the gate is holding, or will hold, the rotation.
+func (g *pauseGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.paused
+}
+
+// wait blocks while the gate is paused or until the context is cancelled.
+// onPause and onResume are only called if the gate actually held the rotation.
+func (g *pauseGate) wait(ctx context.Context, onPause, onResume func()) error {
+	g.mu.Lock()
+	if !g.paused {
+		g.mu.Unlock()
+		return nil
+	}
+	resumed := g.resumed
+	g.mu.Unlock()
+
+	onPause()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-resumed:
+	}
+	onResume()
+
+	return nil
+}
@@ -0,0 +1,522 @@
+// Package jobs keeps track of the rotation and drain jobs run by the rotator server.
+package jobs
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mattermost/rotator/model"
+	"github.com/mattermost/rotator/rotator"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// nodeLockPrefix distinguishes the locks of nodes from those of clusters.
+const nodeLockPrefix = "node/"
+
+// Registry tracks the state of every rotation and drain job started by the server.
+type Registry struct {
+	mu      sync.RWMutex
+	records map[string]*Record
+	cancels map[string]context.CancelFunc
+	gates   map[string]*pauseGate
+	lost    map[string]error
+	store   Store
+	locker  Locker
+	logger  logrus.FieldLogger
+}
+
+// NewRegistry creates a new, empty job registry. If store is nil, jobs are
+// only kept in memory. If locker is nil, clusters are locked in memory.
+func NewRegistry(store Store, locker Locker, logger logrus.FieldLogger) *Registry {
+	if locker == nil {
+		locker = NewMemoryLocker()
+	}
+
+	r := &Registry{
+		records: make(map[string]*Record),
+		cancels: make(map[string]context.CancelFunc),
+		gates:   make(map[string]*pauseGate),
+		lost:    make(map[string]error),
+		store:   store,
+		locker:  locker,
+		logger:  logger,
+	}
+	if notifier, ok := locker.(LostLockNotifier); ok {
+		notifier.NotifyLost(r.lockLost)
+	}
+
+	return r
+}
+
+// StartRotation registers a new cluster rotation job and runs it in the
+// background. A *model.ClusterLockedError is returned if another job is
+// already acting on the cluster.
+func (r *Registry) StartRotation(cluster *model.Cluster) (*model.Job, error) {
+	record, err := r.create(&model.Job{
+		Type:    model.JobTypeRotate,
+		Cluster: cluster,
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.runRotation(record.Job.ID, cluster, &rotator.RotatorMetadata{}, false)
+
+	return copyJob(&record.Job), nil
+}
+
+// StartDrain registers a new node drain job and runs it in the background.
+// A *model.ClusterLockedError is returned if another job is already acting on
+// the cluster of the node or, if the cluster is not given, on the node.
+func (r *Registry) StartDrain(node *model.NodeDrain) (*model.Job, error) {
+	record, err := r.create(&model.Job{
+		Type:      model.JobTypeDrain,
+		Nodes:     []string{node.NodeName},
+		NodeDrain: node,
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.runDrain(record.Job.ID, node)
+
+	return copyJob(&record.Job), nil
+}
+
+// Get returns a copy of the job with the given ID, or nil if no such job exists.
+func (r *Registry) Get(id string) *model.Job {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, ok := r.records[id]
+	if !ok {
+		return nil
+	}
+
+	return copyJob(&record.Job)
+}
+
+// Cancel stops the job with the given ID at its next safe point. It returns
+// nil if no such job exists.
+func (r *Registry) Cancel(id string) *model.Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[id]
+	if !ok {
+		return nil
+	}
+
+	if cancel, ok := r.cancels[id]; ok {
+		r.logger.WithField("job", id).Infof("Cancelling %s job", record.Job.Type)
+		cancel()
+	}
+
+	return copyJob(&record.Job)
+}
+
+// Pause holds the rotation job with the given ID once its current batch of
+// nodes is rotated. It returns nil if no such job exists.
+func (r *Registry) Pause(id string) (*model.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[id]
+	if !ok {
+		return nil, nil
+	}
+
+	gate, ok := r.gates[id]
+	if !ok || record.Job.Type != model.JobTypeRotate {
+		return nil, errors.Errorf("unable to pause %s job in state %s", record.Job.Type, record.Job.State)
+	}
+
+	r.logger.WithField("job", id).Info("Pausing rotation at the next node boundary")
+	gate.pause()
+
+	return copyJob(&record.Job), nil
+}
+
+// Resume continues the paused rotation job with the given ID. A cancelled
+// rotation is restarted from its last checkpoint. It returns nil if no such
+// job exists.
+func (r *Registry) Resume(id string) (*model.Job, error) {
+	r.mu.Lock()
+	record, ok := r.records[id]
+	if !ok {
+		r.mu.Unlock()
+		return nil, nil
+	}
+
+	if gate, ok := r.gates[id]; ok && gate.isPaused() {
+		r.logger.WithField("job", id).Info("Resuming paused rotation")
+		gate.resume()
+		job := copyJob(&record.Job)
+		r.mu.Unlock()
+		return job, nil
+	}
+
+	if record.Job.Type != model.JobTypeRotate || record.Job.State != model.JobStateCancelled || record.Job.Cluster == nil {
+		r.mu.Unlock()
+		return nil, errors.Errorf("unable to resume %s job in state %s", record.Job.Type, record.Job.State)
+	}
+
+	err := r.lockCluster(&record.Job)
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+
+	r.logger.WithField("job", id).Info("Restarting cancelled rotation")
+	metadata := &rotator.RotatorMetadata{}
+	if record.Metadata != nil {
+		metadata = record.Metadata.Copy()
+	}
+	record.Job.State = model.JobStatePending
+	record.Job.EndAt = 0
+	record.Job.Error = ""
+	r.save(record)
+	job := copyJob(&record.Job)
+	r.mu.Unlock()
+
+	r.runRotation(id, job.Cluster, metadata, false)
+
+	return job, nil
+}
+
+// Restore loads the jobs from the store and restarts every job that was
+// pending, running or paused when the server stopped.
+func (r *Registry) Restore() error {
+	if r.store == nil {
+		return nil
+	}
+
+	records, err := r.store.GetJobs()
+	if err != nil {
+		return errors.Wrap(err, "failed to load jobs from store")
+	}
+
+	var resumable []*Record
+	r.mu.Lock()
+	for _, record := range records {
+		r.records[record.Job.ID] = record
+		if !record.Job.IsDone() {
+			resumable = append(resumable, record)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, record := range resumable {
+		job := record.Job
+		r.logger.WithField("job", job.ID).Infof("Resuming %s job", job.Type)
+
+		err = r.lockCluster(&job)
+		if err != nil {
+			r.finish(context.Background(), job.ID, errors.Wrap(err, "unable to resume job"))
+			continue
+		}
+
+		switch {
+		case job.Type == model.JobTypeRotate && job.Cluster != nil:
+			metadata := record.Metadata
+			if metadata == nil {
+				metadata = &rotator.RotatorMetadata{}
+			}
+			r.runRotation(job.ID, job.Cluster, metadata, job.State == model.JobStatePaused)
+		case job.Type == model.JobTypeDrain && job.NodeDrain != nil:
+			r.runDrain(job.ID, job.NodeDrain)
+		default:
+			r.finish(context.Background(), job.ID, errors.Errorf("unable to resume %s job", job.Type))
+		}
+	}
+
+	return nil
+}
+
+func (r *Registry) runRotation(id string, cluster *model.Cluster, rotatorMetadata *rotator.RotatorMetadata, paused bool) {
+	logger := r.logger.WithFields(logrus.Fields{
+		"cluster": cluster.ClusterID,
+		"job":     id,
+	})
+
+	gate := newPauseGate(paused)
+	rotatorMetadata.Checkpoint = func(metadata *rotator.RotatorMetadata) {
+		r.checkpoint(id, metadata)
+	}
+	rotatorMetadata.Hold = func(ctx context.Context) error {
+		return gate.wait(ctx, func() {
+			logger.Info("Rotation paused")
+			r.setState(id, model.JobStatePaused)
+		}, func() {
+			logger.Info("Rotation resumed")
+			r.setState(id, model.JobStateRunning)
+		})
+	}
+
+	ctx := r.newContext(id)
+	r.mu.Lock()
+	r.gates[id] = gate
+	r.mu.Unlock()
+
+	go func() {
+		r.setRunning(id)
+		_, err := rotator.InitRotateClusterWithContext(ctx, cluster, rotatorMetadata, logger)
+		r.finish(ctx, id, err)
+	}()
+}
+
+func (r *Registry) runDrain(id string, node *model.NodeDrain) {
+	logger := r.logger.WithFields(logrus.Fields{
+		"node": node.NodeName,
+		"job":  id,
+	})
+
+	ctx := r.newContext(id)
+	go func() {
+		r.setRunning(id)
+		err := rotator.InitDrainNodeWithContext(ctx, node, logger)
+		r.finish(ctx, id, err)
+	}()
+}
+
+// newContext creates the context of a job, which is cancelled by Cancel.
+func (r *Registry) newContext(id string) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancels[id] = cancel
+	if _, ok := r.lost[id]; ok {
+		cancel()
+	}
+
+	return ctx
+}
+
+// lockLost stops the job that lost the lock of its cluster at its next safe
+// point. The job fails, since another job may now act on the cluster.
+func (r *Registry) lockLost(clusterID, jobID string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[jobID]
+	if !ok || record.Job.IsDone() {
+		return
+	}
+
+	r.logger.WithError(err).WithField("job", jobID).Errorf("Lost the lock of cluster %s, stopping %s job", clusterID, record.Job.Type)
+	r.lost[jobID] = errors.Wrapf(err, "lost the lock of cluster %s", clusterID)
+	if cancel, ok := r.cancels[jobID]; ok {
+		cancel()
+	}
+}
+
+func (r *Registry) create(job *model.Job) (*Record, error) {
+	job.ID = model.NewID()
+	job.State = model.JobStatePending
+
+	err := r.lockCluster(job)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &Record{Job: *job}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records[job.ID] = record
+	r.save(record)
+
+	return record, nil
+}
+
+// lockCluster acquires the lock of the cluster the job acts on or, for drains
+// of a node whose cluster is not given, the lock of the node.
+func (r *Registry) lockCluster(job *model.Job) error {
+	lockID := jobLockID(job)
+	if lockID == "" {
+		return nil
+	}
+
+	owner, err := r.locker.Lock(lockID, job.ID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to lock %s", lockID)
+	}
+	if owner != job.ID {
+		lockedErr := &model.ClusterLockedError{ClusterID: jobClusterID(job), JobID: owner}
+		if lockedErr.ClusterID == "" {
+			lockedErr.NodeName = job.NodeDrain.NodeName
+		}
+		return lockedErr
+	}
+
+	return nil
+}
+
+// unlockCluster releases the lock taken by lockCluster.
+func (r *Registry) unlockCluster(job *model.Job) {
+	lockID := jobLockID(job)
+	if lockID == "" {
+		return
+	}
+
+	err := r.locker.Unlock(lockID, job.ID)
+	if err != nil {
+		r.logger.WithError(err).WithField("job", job.ID).Errorf("Failed to unlock %s", lockID)
+	}
+}
+
+// jobClusterID returns the ID of the cluster the job acts on, if known.
+func jobClusterID(job *model.Job) string {
+	if job.Cluster != nil {
+		return job.Cluster.ClusterID
+	}
+	if job.NodeDrain != nil {
+		return job.NodeDrain.ClusterID
+	}
+
+	return ""
+}
+
+// jobLockID returns the ID of the lock the job holds while it runs: the
+// cluster it acts on or, for drains of a node whose cluster is not given,
+// the node.
+func jobLockID(job *model.Job) string {
+	if clusterID := jobClusterID(job); clusterID != "" {
+		return clusterID
+	}
+	if job.NodeDrain != nil && job.NodeDrain.NodeName != "" {
+		return nodeLockPrefix + job.NodeDrain.NodeName
+	}
+
+	return ""
+}
+
+func (r *Registry) setRunning(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record := r.records[id]
+	if record.Job.State != model.JobStatePaused {
+		record.Job.State = model.JobStateRunning
+	}
+	if record.Job.StartAt == 0 {
+		record.Job.StartAt = model.GetMillis()
+	}
+	r.save(record)
+}
+
+func (r *Registry) setState(id, state string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record := r.records[id]
+	record.Job.State = state
+	r.save(record)
+}
+
+// checkpoint records and persists the progress reported by a running rotation.
+func (r *Registry) checkpoint(id string, metadata *rotator.RotatorMetadata) {
+	var nodes []string
+	var skipped []model.SkippedNode
+	var rolledBack []model.RollbackAction
+	var groupErrors []string
+	var blockingPDBs []model.BlockingPDB
+	for _, groups := range [][]rotator.AutoscalingGroup{metadata.MasterGroups, metadata.WorkerGroups} {
+		for _, asg := range groups {
+			nodes = append(nodes, asg.Nodes...)
+			skipped = append(skipped, asg.Skipped...)
+			rolledBack = append(rolledBack, asg.RolledBack...)
+			blockingPDBs = append(blockingPDBs, asg.BlockingPDBs...)
+			for _, groupError := range asg.Errors {
+				groupErrors = append(groupErrors, asg.Name+": "+groupError)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record := r.records[id]
+	record.Job.CurrentASG = metadata.CurrentGroup
+	record.Job.Nodes = nodes
+	record.Job.Skipped = skipped
+	record.Job.RolledBack = rolledBack
+	record.Job.Errors = groupErrors
+	record.Job.BlockingPDBs = blockingPDBs
+	record.Metadata = metadata.Copy()
+	r.save(record)
+}
+
+// finish records the outcome of a job. A job that failed after its context
+// was cancelled is considered cancelled.
+func (r *Registry) finish(ctx context.Context, id string, err error) {
+	r.mu.Lock()
+
+	cancelled := err != nil && ctx.Err() != nil
+	if cancel, ok := r.cancels[id]; ok {
+		cancel()
+		delete(r.cancels, id)
+	}
+	delete(r.gates, id)
+	lostErr, lost := r.lost[id]
+	delete(r.lost, id)
+
+	record := r.records[id]
+	record.Job.EndAt = model.GetMillis()
+	if lost {
+		record.Job.State = model.JobStateFailed
+		record.Job.Error = lostErr.Error()
+		if err != nil {
+			record.Job.Error += ": " + err.Error()
+		}
+	} else if cancelled {
+		record.Job.State = model.JobStateCancelled
+		record.Job.Error = err.Error()
+	} else if err != nil {
+		record.Job.State = model.JobStateFailed
+		record.Job.Error = err.Error()
+	} else {
+		record.Job.State = model.JobStateSucceeded
+		record.Job.Nodes = nil
+	}
+	r.save(record)
+	job := copyJob(&record.Job)
+	r.mu.Unlock()
+
+	r.unlockCluster(job)
+}
+
+// save persists the record, if a store is configured. Must be called with the lock held.
+func (r *Registry) save(record *Record) {
+	if r.store == nil {
+		return
+	}
+
+	err := r.store.SaveJob(record)
+	if err != nil {
+		r.logger.WithError(err).WithField("job", record.Job.ID).Error("Failed to persist job")
+	}
+}
+
+// copyJob returns a copy of the job that is safe to hand out while the job is still running.
+func copyJob(job *model.Job) *model.Job {
+	jobCopy := *job
+	if job.Nodes != nil {
+		jobCopy.Nodes = append([]string{}, job.Nodes...)
+	}
+	if job.Skipped != nil {
+		jobCopy.Skipped = append([]model.SkippedNode{}, job.Skipped...)
+	}
+	if job.RolledBack != nil {
+		jobCopy.RolledBack = append([]model.RollbackAction{}, job.RolledBack...)
+	}
+	if job.Errors != nil {
+		jobCopy.Errors = append([]string{}, job.Errors...)
+	}
+	if job.BlockingPDBs != nil {
+		jobCopy.BlockingPDBs = append([]model.BlockingPDB{}, job.BlockingPDBs...)
+	}
+
+	return &jobCopy
+}
@@ -0,0 +1,377 @@
+package jobs
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mattermost/rotator/model"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ScheduleInterval is how often the scheduler checks for due rotations and
+// maintenance window changes.
+var ScheduleInterval = 30 * time.Second
+
+// Scheduler launches the rotations of schedules when they are due and keeps
+// them within their maintenance windows, pausing running rotations when the
+// window closes and resuming them when it opens again.
+type Scheduler struct {
+	mu        sync.Mutex
+	schedules map[string]*model.Schedule
+	registry  *Registry
+	store     ScheduleStore
+	logger    logrus.FieldLogger
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewScheduler creates a new scheduler starting its rotations in the given
+// registry. If store is nil, schedules are only kept in memory.
+func NewScheduler(registry *Registry, store ScheduleStore, logger logrus.FieldLogger) *Scheduler {
+	return &Scheduler{
+		schedules: make(map[string]*model.Schedule),
+		registry:  registry,
+		store:     store,
+		logger:    logger,
+	}
+}
+
+// Start loads the persisted schedules and begins checking them in the background.
+// Rotations that became due while the server was down are launched once.
+func (s *Scheduler) Start() error {
+	if s.store != nil {
+		schedules, err := s.store.GetSchedules()
+		if err != nil {
+			return errors.Wrap(err, "failed to load schedules")
+		}
+
+		s.mu.Lock()
+		for _, schedule := range schedules {
+			s.schedules[schedule.ID] = schedule
+		}
+		s.mu.Unlock()
+		s.logger.Infof("Loaded %d schedules", len(schedules))
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run()
+
+	return nil
+}
+
+// Stop stops checking the schedules. Rotations already launched keep running.
+func (s *Scheduler) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(ScheduleInterval)
+	defer ticker.Stop()
+
+	s.tick(time.Now())
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.tick(now)
+		}
+	}
+}
+
+// Create registers a new schedule from the given request.
+func (s *Scheduler) Create(request *model.ScheduleRequest) (*model.Schedule, error) {
+	now := time.Now()
+	schedule := &model.Schedule{
+		ID:        model.NewID(),
+		ClusterID: request.Rotation.ClusterID,
+		Cron:      request.Cron,
+		Window:    request.Window,
+		Rotation:  request.Rotation,
+		CreateAt:  model.GetMillis(),
+	}
+	next, err := schedule.NextRun(now)
+	if err != nil {
+		return nil, err
+	}
+	schedule.NextRunAt = model.GetMillisAtTime(next)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.save(schedule)
+	if err != nil {
+		return nil, err
+	}
+	s.schedules[schedule.ID] = schedule
+
+	return copySchedule(schedule), nil
+}
+
+// Get returns the schedule with the given ID, or nil if it does not exist.
+func (s *Scheduler) Get(id string) *model.Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return nil
+	}
+
+	return copySchedule(schedule)
+}
+
+// List returns all the schedules, oldest first.
+func (s *Scheduler) List() []*model.Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules := make([]*model.Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, copySchedule(schedule))
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].CreateAt < schedules[j].CreateAt
+	})
+
+	return schedules
+}
+
+// Update replaces the parameters of the schedule with the given ID and
+// computes its next run. It returns nil if the schedule does not exist.
+func (s *Scheduler) Update(id string, request *model.ScheduleRequest) (*model.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.schedules[id]
+	if !ok {
+		return nil, nil
+	}
+
+	schedule := copySchedule(existing)
+	schedule.ClusterID = request.Rotation.ClusterID
+	schedule.Cron = request.Cron
+	schedule.Window = request.Window
+	schedule.Rotation = request.Rotation
+	next, err := schedule.NextRun(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	schedule.NextRunAt = model.GetMillisAtTime(next)
+
+	err = s.save(schedule)
+	if err != nil {
+		return nil, err
+	}
+	s.schedules[id] = schedule
+
+	return copySchedule(schedule), nil
+}
+
+// Delete removes the schedule with the given ID and returns it, or nil if it
+// does not exist. A rotation already launched by the schedule keeps running.
+func (s *Scheduler) Delete(id string) (*model.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return nil, nil
+	}
+
+	if s.store != nil {
+		err := s.store.DeleteSchedule(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	delete(s.schedules, id)
+
+	return schedule, nil
+}
+
+// dueRotation is the rotation of a schedule that is due to start.
+type dueRotation struct {
+	schedule *model.Schedule
+	cluster  *model.Cluster
+	next     time.Time
+	logger   logrus.FieldLogger
+}
+
+// tick launches the due rotations and pauses or resumes the running ones
+// according to their maintenance windows. The rotations are started without
+// holding the lock of the schedules, since locking their cluster may block.
+func (s *Scheduler) tick(now time.Time) {
+	for _, rotation := range s.checkSchedules(now) {
+		job, err := s.registry.StartRotation(rotation.cluster)
+		s.started(rotation, job, err)
+	}
+}
+
+// checkSchedules handles the schedules and returns their due rotations.
+func (s *Scheduler) checkSchedules(now time.Time) []*dueRotation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*dueRotation
+	for _, schedule := range s.schedules {
+		logger := s.logger.WithFields(logrus.Fields{
+			"schedule": schedule.ID,
+			"cluster":  schedule.ClusterID,
+		})
+
+		changed, rotation, err := s.check(schedule, now, logger)
+		if err != nil {
+			logger.WithError(err).Error("Failed to run schedule")
+		}
+		if rotation != nil {
+			due = append(due, rotation)
+		}
+		if changed {
+			err = s.save(schedule)
+			if err != nil {
+				logger.WithError(err).Error("Failed to persist schedule")
+			}
+		}
+	}
+
+	return due
+}
+
+// check handles a single schedule and reports whether it was changed and
+// the rotation to start, if it is due.
+func (s *Scheduler) check(schedule *model.Schedule, now time.Time, logger logrus.FieldLogger) (bool, *dueRotation, error) {
+	windowOpen := true
+	if schedule.Window != "" {
+		window, err := model.ParseMaintenanceWindow(schedule.Window)
+		if err != nil {
+			return false, nil, err
+		}
+		windowOpen = window.Contains(now)
+	}
+
+	if schedule.LastJobID != "" {
+		job := s.registry.Get(schedule.LastJobID)
+		if job != nil && !job.IsDone() {
+			return s.checkWindow(schedule, job, windowOpen, logger), nil, nil
+		}
+		if schedule.PausedByWindow {
+			schedule.PausedByWindow = false
+			return true, nil, nil
+		}
+	}
+
+	if !windowOpen || now.Before(model.TimeFromMillis(schedule.NextRunAt)) {
+		return false, nil, nil
+	}
+
+	next, err := schedule.NextRun(now)
+	if err != nil {
+		return false, nil, err
+	}
+
+	return false, &dueRotation{
+		schedule: schedule,
+		cluster:  schedule.Rotation.ToCluster(),
+		next:     next,
+		logger:   logger,
+	}, nil
+}
+
+// started records the outcome of starting the due rotation of a schedule.
+// The schedule may have been updated or deleted in the meantime, in which
+// case its new next run is kept.
+func (s *Scheduler) started(rotation *dueRotation, job *model.Job, err error) {
+	logger := rotation.logger
+	if err != nil {
+		var lockedErr *model.ClusterLockedError
+		if errors.As(err, &lockedErr) {
+			// Try again on a later tick, as long as the window is open.
+			logger.WithError(err).Warn("Cluster is busy, delaying scheduled rotation")
+			return
+		}
+		logger.WithError(err).Error("Failed to start scheduled rotation")
+	} else {
+		logger.WithField("job", job.ID).Info("Started scheduled rotation")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[rotation.schedule.ID]
+	if !ok {
+		return
+	}
+	if job != nil {
+		schedule.LastJobID = job.ID
+	}
+	if schedule == rotation.schedule {
+		schedule.NextRunAt = model.GetMillisAtTime(rotation.next)
+	}
+
+	err = s.save(schedule)
+	if err != nil {
+		logger.WithError(err).Error("Failed to persist schedule")
+	}
+}
+
+// checkWindow pauses the running job of a schedule when its window closes and
+// resumes it when the window opens again. Jobs paused by hand are left alone.
+func (s *Scheduler) checkWindow(schedule *model.Schedule, job *model.Job, windowOpen bool, logger logrus.FieldLogger) bool {
+	logger = logger.WithField("job", job.ID)
+
+	if windowOpen {
+		if !schedule.PausedByWindow {
+			return false
+		}
+		// The job may still be running towards the node boundary it pauses
+		// at, in which case resuming it lifts the pending pause. A running
+		// job that cannot be resumed was resumed by hand already.
+		_, err := s.registry.Resume(job.ID)
+		if err != nil && job.State == model.JobStatePaused {
+			logger.WithError(err).Error("Failed to resume scheduled rotation")
+			return false
+		}
+		if err == nil {
+			logger.Info("Maintenance window opened, resumed scheduled rotation")
+		}
+		schedule.PausedByWindow = false
+		return true
+	}
+
+	if schedule.PausedByWindow || job.State == model.JobStatePaused {
+		return false
+	}
+	_, err := s.registry.Pause(job.ID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to pause scheduled rotation")
+		return false
+	}
+	logger.Info("Maintenance window closed, pausing scheduled rotation")
+	schedule.PausedByWindow = true
+
+	return true
+}
+
+func (s *Scheduler) save(schedule *model.Schedule) error {
+	if s.store == nil {
+		return nil
+	}
+
+	return s.store.SaveSchedule(schedule)
+}
+
+func copySchedule(schedule *model.Schedule) *model.Schedule {
+	scheduleCopy := *schedule
+	return &scheduleCopy
+}
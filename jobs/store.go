@@ -0,0 +1,193 @@
+package jobs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattermost/rotator/model"
+	"github.com/mattermost/rotator/rotator"
+	"github.com/pkg/errors"
+)
+
+// schedulesDir is the subdirectory of the store directory where schedules are kept.
+const schedulesDir = "schedules"
+
+// Record is a job together with the rotator metadata required to resume it.
+type Record struct {
+	Job      model.Job
+	Metadata *rotator.RotatorMetadata `json:",omitempty"`
+}
+
+// Store is the interface required to persist jobs across server restarts.
+type Store interface {
+	SaveJob(record *Record) error
+	GetJobs() ([]*Record, error)
+}
+
+// ScheduleStore is the interface required to persist schedules across server restarts.
+type ScheduleStore interface {
+	SaveSchedule(schedule *model.Schedule) error
+	DeleteSchedule(id string) error
+	GetSchedules() ([]*model.Schedule, error)
+}
+
+// FileStore is a Store and ScheduleStore that keeps every job and schedule
+// as a JSON file in a local directory.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a file store in the given directory, creating the directory if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(filepath.Join(dir, schedulesDir), 0700)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create job store directory %s", dir)
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+// SaveJob writes the given job record, replacing any previous version of it.
+func (s *FileStore) SaveJob(record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode job %s", record.Job.ID)
+	}
+
+	err = writeFileAtomic(s.path(record.Job.ID), data)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write job %s", record.Job.ID)
+	}
+
+	return nil
+}
+
+// GetJobs returns all the job records in the store.
+func (s *FileStore) GetJobs() ([]*Record, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read job store directory %s", s.dir)
+	}
+
+	var records []*Record
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read job file %s", entry.Name())
+		}
+
+		var record Record
+		err = json.Unmarshal(data, &record)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode job file %s", entry.Name())
+		}
+		records = append(records, &record)
+	}
+
+	return records, nil
+}
+
+// SaveSchedule writes the given schedule, replacing any previous version of it.
+func (s *FileStore) SaveSchedule(schedule *model.Schedule) error {
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode schedule %s", schedule.ID)
+	}
+
+	err = writeFileAtomic(s.schedulePath(schedule.ID), data)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write schedule %s", schedule.ID)
+	}
+
+	return nil
+}
+
+// DeleteSchedule removes the given schedule.
+func (s *FileStore) DeleteSchedule(id string) error {
+	err := os.Remove(s.schedulePath(id))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to delete schedule %s", id)
+	}
+
+	return nil
+}
+
+// GetSchedules returns all the schedules in the store.
+func (s *FileStore) GetSchedules() ([]*model.Schedule, error) {
+	dir := filepath.Join(s.dir, schedulesDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read schedule store directory %s", dir)
+	}
+
+	var schedules []*model.Schedule
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read schedule file %s", entry.Name())
+		}
+
+		var schedule model.Schedule
+		err = json.Unmarshal(data, &schedule)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode schedule file %s", entry.Name())
+		}
+		schedules = append(schedules, &schedule)
+	}
+
+	return schedules, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *FileStore) schedulePath(id string) string {
+	return filepath.Join(s.dir, schedulesDir, id+".json")
+}
+
+// writeFileAtomic replaces the file at path with the given data. The data is
+// written to a temporary file first and synced before the file is renamed over
+// the previous version, and the rename is synced too, so that a crash never
+// leaves a partially written or lost file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
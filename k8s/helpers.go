@@ -2,11 +2,12 @@ package k8s
 
 import (
 	"context"
-	"github.com/mattermost/rotator/aws"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/mattermost/rotator/model"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
@@ -16,13 +17,19 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-func NodesReady(nodes []string, clientset *kubernetes.Clientset, logger *logrus.Entry) error {
-	wait := 600
-	logger.Infof("Waiting up to %d seconds for all nodes to become ready...", wait)
+var (
+	// NodeReadyTimeout is how long to wait for each node to become ready.
+	NodeReadyTimeout = 600 * time.Second
+	// NodeReadyInterval is how often a node is checked while waiting for it to become ready.
+	NodeReadyInterval = 20 * time.Second
+)
+
+func NodesReady(ctx context.Context, nodes []string, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) error {
+	logger.Infof("Waiting up to %s for all nodes to become ready...", NodeReadyTimeout)
 	for _, node := range nodes {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(wait)*time.Second)
-		defer cancel()
-		_, err := WaitForNodeRunning(ctx, node, clientset, logger)
+		nodeCtx, cancel := context.WithTimeout(ctx, NodeReadyTimeout)
+		_, err := WaitForNodeRunning(nodeCtx, node, clientset, provider, logger)
+		cancel()
 		if err != nil {
 			return errors.Wrapf(err, "Node %s failed to get ready", node)
 		}
@@ -34,48 +41,96 @@ func NodesReady(nodes []string, clientset *kubernetes.Clientset, logger *logrus.
 
 // WaitForNodeRunning will poll a given kubernetes node at a regular interval for
 // it to enter the 'Ready' state. If the node fails to become ready before
-// the provided timeout then an error will be returned.
-func WaitForNodeRunning(ctx context.Context, nodeName string, clientset *kubernetes.Clientset, logger *logrus.Entry) (*corev1.Node, error) {
+// the provided timeout then an error will be returned. Nodes not found by name
+// are looked up by the ID of their instance in the provider.
+func WaitForNodeRunning(ctx context.Context, nodeName string, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) (*corev1.Node, error) {
 	for {
-		node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		node, err := GetNode(ctx, nodeName, clientset, provider, logger)
 		if err == nil {
 			for _, condition := range node.Status.Conditions {
 				if condition.Reason == "KubeletReady" && condition.Status == corev1.ConditionTrue {
 					return node, nil
 				} else if condition.Reason == "KubeletReady" && condition.Status == corev1.ConditionFalse {
-					logger.Infof("Node %s found but not ready, waiting...", nodeName)
+					logger.Infof("Node %s found but not ready, waiting...", node.Name)
 				}
 			}
-		}
-		if k8sErrors.IsNotFound(err) {
-			privateIP, _ := aws.ExtractPrivateIP(nodeName)
-			instanceID, _ := aws.GetInstanceIDByPrivateIP(privateIP)
-			node, err2 := clientset.CoreV1().Nodes().Get(ctx, instanceID, metav1.GetOptions{})
-			if err2 == nil {
-				for _, condition := range node.Status.Conditions {
-					if condition.Reason == "KubeletReady" && condition.Status == corev1.ConditionTrue {
-						return node, nil
-					} else if condition.Reason == "KubeletReady" && condition.Status == corev1.ConditionFalse {
-						logger.Infof("Node %s found but not ready, waiting...", node.Name)
-					}
-				}
-			}
-			logger.Infof("Node %s not found, waiting...", node.Name)
-		} else if err != nil {
+		} else if k8sErrors.IsNotFound(err) {
+			logger.Infof("Node %s not found, waiting...", nodeName)
+		} else {
 			logger.WithError(err).Errorf("Error while waiting for node %s to become ready...", nodeName)
 		}
 
 		select {
 		case <-ctx.Done():
 			return nil, errors.Wrap(ctx.Err(), "timed out waiting for node to become ready")
-		case <-time.After(20 * time.Second):
+		case <-time.After(NodeReadyInterval):
+		}
+	}
+}
+
+// InstanceIDFromProviderID returns the ID of the instance backing a node from
+// its provider ID, of the form aws:///<zone>/<instance ID>. It returns an
+// empty string if the provider ID is not in that form.
+func InstanceIDFromProviderID(providerID string) string {
+	if !strings.HasPrefix(providerID, "aws://") {
+		return ""
+	}
+	parts := strings.Split(strings.TrimPrefix(providerID, "aws://"), "/")
+	instanceID := parts[len(parts)-1]
+	if !strings.HasPrefix(instanceID, "i-") {
+		return ""
+	}
+
+	return instanceID
+}
+
+// ResolveInstanceID returns the ID of the instance backing a node, read from
+// the provider ID of the node if it is registered in the cluster and looked up
+// in the provider otherwise. It returns an empty string if no such instance
+// exists.
+func ResolveInstanceID(ctx context.Context, nodeName string, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) (string, error) {
+	node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return "", errors.Wrapf(err, "Failed to get node %s", nodeName)
+	}
+	if err == nil {
+		instanceID := InstanceIDFromProviderID(node.Spec.ProviderID)
+		if instanceID != "" {
+			return instanceID, nil
 		}
 	}
+
+	return provider.GetInstanceID(ctx, nodeName, logger)
 }
 
-func DeleteClusterNodes(nodes []string, clientset *kubernetes.Clientset, logger *logrus.Entry) error {
-	ctx := context.TODO()
+// GetNode gets a node by name. Nodes not found by name, for example because
+// the instance hostname differs from the node name, are looked up by the
+// provider ID of the instance backing them.
+func GetNode(ctx context.Context, nodeName string, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) (*corev1.Node, error) {
+	node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if !k8sErrors.IsNotFound(err) {
+		return node, err
+	}
+
+	instanceID, idErr := provider.GetInstanceID(ctx, nodeName, logger)
+	if idErr != nil || instanceID == "" {
+		return nil, err
+	}
+
+	nodes, listErr := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if listErr != nil {
+		return nil, errors.Wrap(listErr, "Failed to list nodes")
+	}
+	for i := range nodes.Items {
+		if InstanceIDFromProviderID(nodes.Items[i].Spec.ProviderID) == instanceID {
+			return &nodes.Items[i], nil
+		}
+	}
+
+	return nil, err
+}
 
+func DeleteClusterNodes(ctx context.Context, nodes []string, clientset kubernetes.Interface, logger *logrus.Entry) error {
 	for _, node := range nodes {
 		err := clientset.CoreV1().Nodes().Delete(ctx, node, metav1.DeleteOptions{})
 		if k8sErrors.IsNotFound(err) {
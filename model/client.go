@@ -26,6 +26,17 @@ func NewClient(address string) *Client {
 	}
 }
 
+// clusterLockedErrorFromReader decodes the json-encoded error of a conflicting job request.
+func clusterLockedErrorFromReader(reader io.Reader) error {
+	lockedErr := ClusterLockedError{}
+	err := json.NewDecoder(reader).Decode(&lockedErr)
+	if err != nil {
+		return errors.Wrap(err, "failed with status code 409")
+	}
+
+	return &lockedErr
+}
+
 // closeBody ensures the Body of an http.Response is properly closed.
 func closeBody(r *http.Response) {
 	if r.Body != nil {
@@ -39,12 +50,20 @@ func (c *Client) buildURL(urlPath string, args ...interface{}) string {
 }
 
 func (c *Client) doPost(u string, request interface{}) (*http.Response, error) {
+	return c.doWithBody(http.MethodPost, u, request)
+}
+
+func (c *Client) doPut(u string, request interface{}) (*http.Response, error) {
+	return c.doWithBody(http.MethodPut, u, request)
+}
+
+func (c *Client) doWithBody(method, u string, request interface{}) (*http.Response, error) {
 	requestBytes, err := json.Marshal(request)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to marshal request")
 	}
 
-	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(requestBytes))
+	req, err := http.NewRequest(method, u, bytes.NewReader(requestBytes))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create http request")
 	}
@@ -56,32 +75,240 @@ func (c *Client) doPost(u string, request interface{}) (*http.Response, error) {
 	return c.httpClient.Do(req)
 }
 
+func (c *Client) doDelete(u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodDelete, u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create http request")
+	}
+	for k, v := range c.headers {
+		req.Header.Add(k, v)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+func (c *Client) doGet(u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create http request")
+	}
+	for k, v := range c.headers {
+		req.Header.Add(k, v)
+	}
+
+	return c.httpClient.Do(req)
+}
+
 // RotateCluster requests the rotation of a K8s cluster from the rotator server.
-func (c *Client) RotateCluster(request *RotateClusterRequest) (*Cluster, error) {
+func (c *Client) RotateCluster(request *RotateClusterRequest) (*Job, error) {
 	resp, err := c.doPost(c.buildURL("/api/rotate"), request)
 	if err != nil {
 		return nil, err
 	}
 	defer closeBody(resp)
 
-	if resp.StatusCode == http.StatusAccepted {
-		return ClusterFromReader(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusAccepted:
+		return JobFromReader(resp.Body)
+	case http.StatusConflict:
+		return nil, clusterLockedErrorFromReader(resp.Body)
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// PlanClusterRotation requests the plan of a K8s cluster rotation from the rotator server, without rotating any node.
+func (c *Client) PlanClusterRotation(request *RotateClusterRequest) (*RotationPlan, error) {
+	dryRunRequest := *request
+	dryRunRequest.DryRun = true
+
+	resp, err := c.doPost(c.buildURL("/api/rotate"), &dryRunRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode == http.StatusOK {
+		return RotationPlanFromReader(resp.Body)
 	}
 
 	return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
 }
 
 // DrainNode requests the drain of a K8s cluster node from the rotator server.
-func (c *Client) DrainNode(request *DrainNodeRequest) (*NodeDrain, error) {
+func (c *Client) DrainNode(request *DrainNodeRequest) (*Job, error) {
 	resp, err := c.doPost(c.buildURL("/api/drain"), request)
 	if err != nil {
 		return nil, err
 	}
 	defer closeBody(resp)
 
+	switch resp.StatusCode {
+	case http.StatusAccepted:
+		return JobFromReader(resp.Body)
+	case http.StatusConflict:
+		return nil, clusterLockedErrorFromReader(resp.Body)
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// GetRotation fetches the status of the cluster rotation job with the given ID from the rotator server.
+func (c *Client) GetRotation(jobID string) (*Job, error) {
+	return c.getJob(c.buildURL("/api/rotate/%s", jobID))
+}
+
+// GetDrain fetches the status of the node drain job with the given ID from the rotator server.
+func (c *Client) GetDrain(jobID string) (*Job, error) {
+	return c.getJob(c.buildURL("/api/drain/%s", jobID))
+}
+
+func (c *Client) getJob(u string) (*Job, error) {
+	resp, err := c.doGet(u)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return JobFromReader(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// CancelRotation requests the cancellation of the cluster rotation job with the given ID from the rotator server.
+func (c *Client) CancelRotation(jobID string) (*Job, error) {
+	return c.cancelJob(c.buildURL("/api/rotate/%s", jobID))
+}
+
+// CancelDrain requests the cancellation of the node drain job with the given ID from the rotator server.
+func (c *Client) CancelDrain(jobID string) (*Job, error) {
+	return c.cancelJob(c.buildURL("/api/drain/%s", jobID))
+}
+
+func (c *Client) cancelJob(u string) (*Job, error) {
+	resp, err := c.doDelete(u)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
 	if resp.StatusCode == http.StatusAccepted {
-		return NodeDrainFromReader(resp.Body)
+		return JobFromReader(resp.Body)
+	}
+
+	return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+}
+
+// PauseRotation requests the cluster rotation job with the given ID to be held once its current batch of nodes is rotated.
+func (c *Client) PauseRotation(jobID string) (*Job, error) {
+	return c.changeJob(c.buildURL("/api/rotate/%s/pause", jobID))
+}
+
+// ResumeRotation requests the paused or cancelled cluster rotation job with the given ID to continue.
+func (c *Client) ResumeRotation(jobID string) (*Job, error) {
+	return c.changeJob(c.buildURL("/api/rotate/%s/resume", jobID))
+}
+
+func (c *Client) changeJob(u string) (*Job, error) {
+	resp, err := c.doPost(u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusAccepted:
+		return JobFromReader(resp.Body)
+	case http.StatusConflict:
+		return nil, clusterLockedErrorFromReader(resp.Body)
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// CreateSchedule requests the creation of a scheduled cluster rotation from the rotator server.
+func (c *Client) CreateSchedule(request *ScheduleRequest) (*Schedule, error) {
+	resp, err := c.doPost(c.buildURL("/api/schedules"), request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode == http.StatusCreated {
+		return ScheduleFromReader(resp.Body)
 	}
 
 	return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
 }
+
+// GetSchedules fetches all the scheduled cluster rotations from the rotator server.
+func (c *Client) GetSchedules() ([]*Schedule, error) {
+	resp, err := c.doGet(c.buildURL("/api/schedules"))
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode == http.StatusOK {
+		return SchedulesFromReader(resp.Body)
+	}
+
+	return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+}
+
+// GetSchedule fetches the scheduled cluster rotation with the given ID from the rotator server.
+func (c *Client) GetSchedule(scheduleID string) (*Schedule, error) {
+	resp, err := c.doGet(c.buildURL("/api/schedules/%s", scheduleID))
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return ScheduleFromReader(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// UpdateSchedule requests the replacement of the parameters of the scheduled cluster rotation with the given ID.
+func (c *Client) UpdateSchedule(scheduleID string, request *ScheduleRequest) (*Schedule, error) {
+	resp, err := c.doPut(c.buildURL("/api/schedules/%s", scheduleID), request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return ScheduleFromReader(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Errorf("failed with status code %d", resp.StatusCode)
+	}
+}
+
+// DeleteSchedule requests the deletion of the scheduled cluster rotation with the given ID.
+// Rotations already launched by the schedule keep running.
+func (c *Client) DeleteSchedule(scheduleID string) error {
+	resp, err := c.doDelete(c.buildURL("/api/schedules/%s", scheduleID))
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return errors.Errorf("failed with status code %d", resp.StatusCode)
+}
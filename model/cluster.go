@@ -3,22 +3,148 @@ package model
 import (
 	"encoding/json"
 	"io"
+	"time"
 
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	// RotationStrategyDetach detaches worker nodes and waits for the node
+	// group to replace them before draining them.
+	RotationStrategyDetach = "detach"
+	// RotationStrategySurge scales the node group up and waits for the new
+	// nodes before draining and terminating worker nodes.
+	RotationStrategySurge = "surge"
+)
+
+const (
+	// FailurePolicyAbort stops a rotation when a batch of worker nodes fails
+	// to rotate, leaving the nodes as they are.
+	FailurePolicyAbort = "abort"
+	// FailurePolicyRollback stops a rotation when a batch of worker nodes
+	// fails to rotate, after returning the nodes to service and terminating
+	// their broken replacements.
+	FailurePolicyRollback = "rollback"
+	// FailurePolicyContinue rolls back a batch of worker nodes that fails to
+	// rotate, skips its nodes and goes on with the rotation.
+	FailurePolicyContinue = "continue"
+)
+
+const (
+	// PDBPolicyIgnore drains nodes regardless of the PodDisruptionBudgets
+	// covering their pods, retrying evictions until the drain times out.
+	PDBPolicyIgnore = "ignore"
+	// PDBPolicyWait delays a batch of nodes until the PodDisruptionBudgets
+	// covering their pods allow them to be evicted.
+	PDBPolicyWait = "wait"
+	// PDBPolicyRefuse fails a batch of nodes whose pods are covered by
+	// PodDisruptionBudgets not allowing them to be evicted.
+	PDBPolicyRefuse = "refuse"
+)
+
+// DefaultPDBWaitTimeout is how long a batch of nodes is delayed by
+// PodDisruptionBudgets at most with the wait policy, unless set otherwise.
+const DefaultPDBWaitTimeout = 10 * time.Minute
+
 // Cluster represents a K8s cluster.
 type Cluster struct {
-	ClusterID               string
-	MaxScaling              int
-	RotateMasters           bool
-	RotateWorkers           bool
-	MaxDrainRetries         int
-	EvictGracePeriod        int
-	WaitBetweenRotations    int
-	WaitBetweenDrains       int
-	WaitBetweenPodEvictions int
-	ClientSet               *kubernetes.Clientset
+	ClusterID                string
+	MaxScaling               int
+	RotateMasters            bool
+	RotateWorkers            bool
+	MaxDrainRetries          int
+	EvictGracePeriod         int
+	WaitBetweenRotations     int
+	WaitBetweenDrains        int
+	WaitBetweenPodEvictions  int
+	DriftOnly                bool
+	DriftCompareImage        bool
+	DriftCompareType         bool
+	MaxNodeAge               time.Duration
+	Strategy                 string
+	Standby                  bool
+	FailurePolicy            string
+	AutoscalingGroups        []string
+	ClusterTagKeys           []string
+	MasterTagKey             string
+	IncludeAutoscalingGroups []string
+	ExcludeAutoscalingGroups []string
+	Nodes                    []string
+	LabelSelector            string
+	ParallelGroups           int
+	MaxDrainingNodes         int
+	SuspendAZRebalance       bool
+	SuspendProcesses         []string
+	DisableScaleDown         bool
+	PDBPolicy                string
+	PDBWaitTimeout           time.Duration
+	EvictByPriority          bool
+	EvictionNamespaceTiers   [][]string
+	CompletionTimeout        time.Duration
+	CompletionPolicy         string
+	MaxConcurrentEvictions   int
+	// ClientSet is the k8s clientset of the cluster. Uses local config if not set.
+	ClientSet kubernetes.Interface `json:"-"`
+	// Provider manages the node groups of the cluster. Defaults to AWS autoscaling groups.
+	Provider NodeGroupProvider `json:"-"`
+}
+
+// GetFailurePolicy returns the failure policy of the rotation. Rotations
+// putting nodes in standby roll back by default, others abort.
+func (c *Cluster) GetFailurePolicy() string {
+	if c.FailurePolicy != "" {
+		return c.FailurePolicy
+	}
+	if c.Standby {
+		return FailurePolicyRollback
+	}
+
+	return FailurePolicyAbort
+}
+
+// GetPDBPolicy returns the PodDisruptionBudget policy of the rotation.
+func (c *Cluster) GetPDBPolicy() string {
+	if c.PDBPolicy != "" {
+		return c.PDBPolicy
+	}
+
+	return PDBPolicyIgnore
+}
+
+// GetPDBWaitTimeout returns how long a batch of nodes can be delayed by
+// PodDisruptionBudgets with the wait policy.
+func (c *Cluster) GetPDBWaitTimeout() time.Duration {
+	if c.PDBWaitTimeout > 0 {
+		return c.PDBWaitTimeout
+	}
+
+	return DefaultPDBWaitTimeout
+}
+
+// GetSuspendProcesses returns the processes of the node groups suspended
+// while they are rotated.
+func (c *Cluster) GetSuspendProcesses() []string {
+	var processes []string
+	if c.SuspendAZRebalance {
+		processes = append(processes, ProcessAZRebalance)
+	}
+	for _, process := range c.SuspendProcesses {
+		if !containsString(processes, process) {
+			processes = append(processes, process)
+		}
+	}
+
+	return processes
+}
+
+// NodeGroupSelector returns the selector identifying the node groups of the cluster.
+func (c *Cluster) NodeGroupSelector() *NodeGroupSelector {
+	return &NodeGroupSelector{
+		ClusterID:      c.ClusterID,
+		Names:          c.AutoscalingGroups,
+		ClusterTagKeys: c.ClusterTagKeys,
+		MasterTagKey:   c.MasterTagKey,
+	}
 }
 
 // ClusterFromReader decodes a json-encoded cluster from the given io.Reader.
@@ -32,3 +158,14 @@ func ClusterFromReader(reader io.Reader) (*Cluster, error) {
 
 	return &cluster, nil
 }
+
+// containsString returns true if the list contains the value.
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
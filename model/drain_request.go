@@ -3,10 +3,28 @@ package model
 import (
 	"encoding/json"
 	"io"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+const (
+	// CompletionPolicyFail fails the drain of a node whose pods to wait for
+	// do not complete within the completion timeout.
+	CompletionPolicyFail = "fail"
+	// CompletionPolicyEvict evicts the pods to wait for that do not complete
+	// within the completion timeout.
+	CompletionPolicyEvict = "evict"
+)
+
+// DefaultCompletionTimeout is how long the pods to wait for are waited for,
+// unless set otherwise.
+const DefaultCompletionTimeout = 30 * time.Minute
+
+// DefaultMaxConcurrentEvictions is how many pods of a node are evicted at
+// once, unless set otherwise.
+const DefaultMaxConcurrentEvictions = 10
+
 // DrainNodeRequest specifies the parameters for a new cluster node drain.
 type DrainNodeRequest struct {
 	NodeName                string `json:"nodeName,omitempty"`
@@ -14,8 +32,24 @@ type DrainNodeRequest struct {
 	MaxDrainRetries         int    `json:"maxDrainRetries,omitempty"`
 	WaitBetweenPodEvictions int    `json:"waitBetweenPodEvictions,omitempty"`
 	DetachNode              bool   `json:"detachNode,omitempty"`
+	StandbyNode             bool   `json:"standbyNode,omitempty"`
 	TerminateNode           bool   `json:"terminateNode,omitempty"`
 	ClusterID               string `json:"clusterID,omitempty"`
+	// ClusterTagKeys are the keys of the tags identifying the autoscaling
+	// groups of the cluster. Defaults to DefaultClusterTagKeys.
+	ClusterTagKeys []string `json:"clusterTagKeys,omitempty"`
+	// EvictByPriority and EvictionNamespaceTiers order the eviction of the
+	// pods of the node, see ValidateEvictionNamespaceTiers.
+	EvictByPriority        bool       `json:"evictByPriority,omitempty"`
+	EvictionNamespaceTiers [][]string `json:"evictionNamespaceTiers,omitempty"`
+	// CompletionTimeout is how long pods annotated to be waited for are
+	// waited for, and CompletionPolicy what happens to those that do not
+	// complete in time.
+	CompletionTimeout string `json:"completionTimeout,omitempty"`
+	CompletionPolicy  string `json:"completionPolicy,omitempty"`
+	// MaxConcurrentEvictions is how many pods of the node are evicted at
+	// once. Defaults to DefaultMaxConcurrentEvictions.
+	MaxConcurrentEvictions int `json:"maxConcurrentEvictions,omitempty"`
 }
 
 // NewDrainNodeRequestFromReader decodes the request and returns after validation and setting the defaults.
@@ -40,6 +74,75 @@ func (request *DrainNodeRequest) Validate() error {
 	if request.NodeName == "" {
 		return errors.New("Node name cannot be empty")
 	}
+
+	if request.StandbyNode && request.DetachNode {
+		return errors.New("A node cannot be both detached and put in standby")
+	}
+
+	if request.StandbyNode && request.ClusterID == "" {
+		return errors.New("Cluster ID is required to put a node in standby")
+	}
+
+	if request.MaxConcurrentEvictions < 0 {
+		return errors.New("Max concurrent evictions cannot be negative")
+	}
+
+	err := validateCompletion(request.CompletionTimeout, request.CompletionPolicy)
+	if err != nil {
+		return err
+	}
+
+	return ValidateEvictionNamespaceTiers(request.EvictionNamespaceTiers)
+}
+
+// GetCompletionTimeout returns the completion timeout of the request, or zero if not set.
+func (request *DrainNodeRequest) GetCompletionTimeout() time.Duration {
+	completionTimeout, _ := time.ParseDuration(request.CompletionTimeout)
+	return completionTimeout
+}
+
+// validateCompletion validates how long pods to wait for are waited for and
+// what happens to those that do not complete in time.
+func validateCompletion(completionTimeout, completionPolicy string) error {
+	if completionTimeout != "" {
+		timeout, err := time.ParseDuration(completionTimeout)
+		if err != nil {
+			return errors.Wrap(err, "Completion timeout is not a valid duration")
+		}
+		if timeout <= 0 {
+			return errors.New("Completion timeout must be positive")
+		}
+	}
+
+	switch completionPolicy {
+	case "", CompletionPolicyFail, CompletionPolicyEvict:
+	default:
+		return errors.Errorf("Completion policy must be %s or %s", CompletionPolicyFail, CompletionPolicyEvict)
+	}
+
+	return nil
+}
+
+// ValidateEvictionNamespaceTiers validates namespace tiers ordering the
+// eviction of pods. The pods of each tier are evicted after those of the
+// tiers before it, and the pods of namespaces in no tier are evicted first.
+func ValidateEvictionNamespaceTiers(tiers [][]string) error {
+	tierOf := make(map[string]int)
+	for i, tier := range tiers {
+		if len(tier) == 0 {
+			return errors.New("Eviction namespace tiers cannot be empty")
+		}
+		for _, namespace := range tier {
+			if namespace == "" {
+				return errors.New("Eviction namespace tiers cannot have empty namespaces")
+			}
+			if previous, found := tierOf[namespace]; found && previous != i {
+				return errors.Errorf("Namespace %s cannot be in several eviction tiers", namespace)
+			}
+			tierOf[namespace] = i
+		}
+	}
+
 	return nil
 }
 
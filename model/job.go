@@ -0,0 +1,131 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// JobTypeRotate is the type of a job rotating the nodes of a cluster.
+	JobTypeRotate = "rotate"
+	// JobTypeDrain is the type of a job draining a single node.
+	JobTypeDrain = "drain"
+)
+
+const (
+	// JobStatePending is a job that has been accepted but not started yet.
+	JobStatePending = "pending"
+	// JobStateRunning is a job that is currently in progress.
+	JobStateRunning = "running"
+	// JobStatePaused is a rotation job that is being held at a node boundary.
+	JobStatePaused = "paused"
+	// JobStateSucceeded is a job that completed successfully.
+	JobStateSucceeded = "succeeded"
+	// JobStateFailed is a job that stopped because of an error.
+	JobStateFailed = "failed"
+	// JobStateCancelled is a job that was stopped on request before completing.
+	JobStateCancelled = "cancelled"
+)
+
+// Job represents a rotation or drain request tracked by the rotator server.
+type Job struct {
+	ID         string
+	Type       string
+	State      string
+	StartAt    int64
+	EndAt      int64
+	CurrentASG string
+	Nodes      []string
+	Skipped    []SkippedNode    `json:",omitempty"`
+	RolledBack []RollbackAction `json:",omitempty"`
+	Errors     []string         `json:",omitempty"`
+	Error      string
+	Cluster    *Cluster   `json:",omitempty"`
+	NodeDrain  *NodeDrain `json:",omitempty"`
+
+	// BlockingPDBs are the PodDisruptionBudgets currently holding back the
+	// drain of nodes.
+	BlockingPDBs []BlockingPDB `json:",omitempty"`
+}
+
+// SkippedNode is a node that a rotation leaves in place.
+type SkippedNode struct {
+	NodeName string
+	Reason   string
+}
+
+// BlockingPDB is a PodDisruptionBudget that does not allow the pods of a
+// node to be evicted.
+type BlockingPDB struct {
+	NodeName  string
+	Namespace string
+	Name      string
+}
+
+const (
+	// RollbackActionTerminated is a broken replacement node that was terminated.
+	RollbackActionTerminated = "terminated"
+	// RollbackActionReattached is a detached node that was attached to its group again.
+	RollbackActionReattached = "reattached"
+	// RollbackActionReturnedToService is a node in standby that was returned to service.
+	RollbackActionReturnedToService = "returned-to-service"
+	// RollbackActionUncordoned is a cordoned node that was made schedulable again.
+	RollbackActionUncordoned = "uncordoned"
+)
+
+// RollbackAction is an action taken to undo the rotation of a batch of nodes.
+type RollbackAction struct {
+	NodeName string
+	Action   string
+}
+
+// IsDone returns true if the job is no longer in progress.
+func (j *Job) IsDone() bool {
+	return j.State == JobStateSucceeded || j.State == JobStateFailed || j.State == JobStateCancelled
+}
+
+// JobFromReader decodes a json-encoded job from the given io.Reader.
+func JobFromReader(reader io.Reader) (*Job, error) {
+	job := Job{}
+	decoder := json.NewDecoder(reader)
+	err := decoder.Decode(&job)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// GetMillis is a convenience method to get milliseconds since epoch.
+func GetMillis() int64 {
+	return GetMillisAtTime(time.Now())
+}
+
+// GetMillisAtTime returns the milliseconds since epoch of the given time.
+func GetMillisAtTime(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// TimeFromMillis converts milliseconds since epoch to a time.
+func TimeFromMillis(millis int64) time.Time {
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
+
+// ClusterLockedError is returned when a job is requested for a cluster that
+// another job is already acting on. For drains of a node whose cluster is not
+// given, the node is locked instead of the cluster.
+type ClusterLockedError struct {
+	ClusterID string
+	NodeName  string `json:",omitempty"`
+	JobID     string
+}
+
+func (e *ClusterLockedError) Error() string {
+	if e.ClusterID == "" && e.NodeName != "" {
+		return fmt.Sprintf("node %s is locked by job %s", e.NodeName, e.JobID)
+	}
+
+	return fmt.Sprintf("cluster %s is locked by job %s", e.ClusterID, e.JobID)
+}
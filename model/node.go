@@ -3,6 +3,9 @@ package model
 import (
 	"encoding/json"
 	"io"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
 )
 
 // NodeDrain represents a K8s node to be drained.
@@ -12,8 +15,19 @@ type NodeDrain struct {
 	WaitBetweenPodEvictions int
 	MaxDrainRetries         int
 	DetachNode              bool
+	StandbyNode             bool
 	TerminateNode           bool
 	ClusterID               string
+	ClusterTagKeys          []string
+	EvictByPriority         bool
+	EvictionNamespaceTiers  [][]string
+	CompletionTimeout       time.Duration
+	CompletionPolicy        string
+	MaxConcurrentEvictions  int
+	// ClientSet is the k8s clientset of the cluster. Uses local config if not set.
+	ClientSet kubernetes.Interface `json:"-"`
+	// Provider manages the node groups of the cluster. Defaults to AWS autoscaling groups.
+	Provider NodeGroupProvider `json:"-"`
 }
 
 // NodeFromReader decodes a json-encoded node from the given io.Reader.
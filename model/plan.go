@@ -0,0 +1,42 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// RotationPlan describes what a cluster rotation would do, without doing it.
+type RotationPlan struct {
+	ClusterID string
+	Batches   []RotationBatch
+	Skipped   []SkippedNode `json:",omitempty"`
+}
+
+// RotationBatch is a set of nodes of an autoscaling group that would be rotated together.
+type RotationBatch struct {
+	AutoscalingGroup string
+	Role             string
+	Nodes            []NodePlan
+}
+
+// NodePlan describes the drain of a single node in a rotation plan.
+type NodePlan struct {
+	NodeName     string
+	PodsToEvict  []string
+	BlockingPDBs []string
+	// Warnings are the parts of the drain that could not be planned.
+	Warnings []string `json:",omitempty"`
+	Error    string
+}
+
+// RotationPlanFromReader decodes a json-encoded rotation plan from the given io.Reader.
+func RotationPlanFromReader(reader io.Reader) (*RotationPlan, error) {
+	plan := RotationPlan{}
+	decoder := json.NewDecoder(reader)
+	err := decoder.Decode(&plan)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return &plan, nil
+}
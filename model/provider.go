@@ -0,0 +1,224 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ClusterIDPlaceholder is replaced by the cluster ID in cluster tag keys.
+	ClusterIDPlaceholder = "{clusterID}"
+)
+
+const (
+	// ProcessAZRebalance is the node group process balancing instances
+	// across availability zones, terminating instances to do so.
+	ProcessAZRebalance = "AZRebalance"
+	// ProcessReplaceUnhealthy is the node group process terminating
+	// instances marked unhealthy and replacing them.
+	ProcessReplaceUnhealthy = "ReplaceUnhealthy"
+	// ProcessScheduledActions is the node group process running the
+	// scheduled scaling actions of the group.
+	ProcessScheduledActions = "ScheduledActions"
+)
+
+// SuspendableProcesses are the node group processes that can be suspended
+// while node groups are rotated.
+var SuspendableProcesses = []string{ProcessAZRebalance, ProcessReplaceUnhealthy, ProcessScheduledActions}
+
+// DefaultClusterTagKeys are the keys of the tags identifying the node groups
+// of a cluster by default, as set by kops and the Kubernetes cloud provider.
+var DefaultClusterTagKeys = []string{"KubernetesCluster", "kubernetes.io/cluster/" + ClusterIDPlaceholder}
+
+// DefaultMasterTagKeys are the keys of the tags marking node groups of
+// masters by default, as set by older and newer versions of kops.
+var DefaultMasterTagKeys = []string{"k8s.io/role/master", "k8s.io/role/control-plane"}
+
+// NodeGroupSelector identifies the node groups of a cluster.
+type NodeGroupSelector struct {
+	ClusterID string
+	// Names are the names of the node groups of the cluster. If set, node
+	// groups are not discovered by their tags.
+	Names []string
+	// ClusterTagKeys are the keys of the tags identifying the node groups of
+	// the cluster. A node group belongs to the cluster if it has a tag with
+	// any of the keys and the cluster ID as value or, for keys containing
+	// ClusterIDPlaceholder, a tag with the key naming the cluster, whatever
+	// its value. Defaults to DefaultClusterTagKeys.
+	ClusterTagKeys []string
+	// MasterTagKey is the key of the tag marking node groups of masters.
+	// Defaults to any of DefaultMasterTagKeys.
+	MasterTagKey string
+}
+
+// GetClusterTagKeys returns the keys of the tags identifying the node groups of the cluster.
+func (selector *NodeGroupSelector) GetClusterTagKeys() []string {
+	if len(selector.ClusterTagKeys) == 0 {
+		return DefaultClusterTagKeys
+	}
+
+	return selector.ClusterTagKeys
+}
+
+// GetMasterTagKeys returns the keys of the tags marking node groups of masters.
+func (selector *NodeGroupSelector) GetMasterTagKeys() []string {
+	if selector.MasterTagKey == "" {
+		return DefaultMasterTagKeys
+	}
+
+	return []string{selector.MasterTagKey}
+}
+
+// IsMaster returns true if a node group with the given tags is a group of masters.
+func (selector *NodeGroupSelector) IsMaster(tags map[string]string) bool {
+	for _, tagKey := range selector.GetMasterTagKeys() {
+		if _, ok := tags[tagKey]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClusterTag returns the tag a node group of the cluster has for the given
+// cluster tag key. If the key names the cluster, any value matches and the
+// returned value is empty.
+func (selector *NodeGroupSelector) ClusterTag(tagKey string) (key, value string) {
+	if strings.Contains(tagKey, ClusterIDPlaceholder) {
+		return strings.ReplaceAll(tagKey, ClusterIDPlaceholder, selector.ClusterID), ""
+	}
+
+	return tagKey, selector.ClusterID
+}
+
+// Matches returns true if a node group with the given name and tags belongs to the cluster.
+func (selector *NodeGroupSelector) Matches(name string, tags map[string]string) bool {
+	if len(selector.Names) > 0 {
+		for _, selectedName := range selector.Names {
+			if selectedName == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, tagKey := range selector.GetClusterTagKeys() {
+		key, value := selector.ClusterTag(tagKey)
+		tagValue, ok := tags[key]
+		if ok && (value == "" || tagValue == value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NodeGroup is a group of cloud instances backing cluster nodes, such as an AWS autoscaling group.
+type NodeGroup struct {
+	Name            string
+	DesiredCapacity int
+	MaxSize         int
+	// Master is true if the group is tagged as a group of masters.
+	Master bool
+	// SuspendedProcesses are the processes of the group that are suspended.
+	SuspendedProcesses []string
+	// LaunchConfiguration identifies the launch template version or launch
+	// configuration new instances are launched with.
+	LaunchConfiguration string
+	// ImageID and InstanceType are those of new instances, if known.
+	ImageID      string
+	InstanceType string
+	Instances    []Instance
+}
+
+// Instance is a cloud instance that is a member of a node group.
+type Instance struct {
+	ID                  string
+	NodeName            string
+	AvailabilityZone    string
+	LaunchConfiguration string
+	ImageID             string
+	InstanceType        string
+	// LaunchTime is when the instance was launched, if known.
+	LaunchTime time.Time
+	// Standby is true if the instance was put in standby. Standby instances
+	// do not count towards the capacity of the group.
+	Standby bool
+}
+
+// NodeNames returns the node names of the instances in the group.
+func (group *NodeGroup) NodeNames() []string {
+	var nodeNames []string
+	for _, instance := range group.Instances {
+		nodeNames = append(nodeNames, instance.NodeName)
+	}
+
+	return nodeNames
+}
+
+// HasInstance returns true if the instance with the given ID is a member of the group.
+func (group *NodeGroup) HasInstance(instanceID string) bool {
+	for _, instance := range group.Instances {
+		if instance.ID == instanceID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Drift returns the reason why the instance differs from the instances the
+// group currently launches, or an empty string if it is up to date. The image
+// and instance type are only compared if requested and known for the group.
+func (group *NodeGroup) Drift(instance Instance, compareImage, compareInstanceType bool) string {
+	if group.LaunchConfiguration != "" && instance.LaunchConfiguration != group.LaunchConfiguration {
+		return fmt.Sprintf("launched from %q instead of %q", instance.LaunchConfiguration, group.LaunchConfiguration)
+	}
+	if compareImage && group.ImageID != "" && instance.ImageID != group.ImageID {
+		return fmt.Sprintf("runs image %q instead of %q", instance.ImageID, group.ImageID)
+	}
+	if compareInstanceType && group.InstanceType != "" && instance.InstanceType != group.InstanceType {
+		return fmt.Sprintf("is of type %q instead of %q", instance.InstanceType, group.InstanceType)
+	}
+
+	return ""
+}
+
+// NodeGroupProvider is the interface to the cloud provider managing the node groups of a cluster.
+type NodeGroupProvider interface {
+	// GetNodeGroups returns the node groups of the cluster identified by the selector.
+	GetNodeGroups(ctx context.Context, selector *NodeGroupSelector) ([]*NodeGroup, error)
+	// GetNodeGroup returns the node group with the given name.
+	GetNodeGroup(ctx context.Context, name string) (*NodeGroup, error)
+	// GetInstanceID returns the ID of the instance backing the node, or an
+	// empty string if no such instance exists.
+	GetInstanceID(ctx context.Context, nodeName string, logger *logrus.Entry) (string, error)
+	// DetachNodes removes the instances from the node group, decrementing
+	// its desired capacity if requested.
+	DetachNodes(ctx context.Context, decrement bool, instanceIDs []string, groupName string, logger *logrus.Entry) error
+	// AttachNodes adds the instances to the node group, incrementing its
+	// desired capacity.
+	AttachNodes(ctx context.Context, instanceIDs []string, groupName string, logger *logrus.Entry) error
+	// EnterStandby puts the instances in standby, keeping them in the node
+	// group but out of service. Unless the desired capacity is decremented,
+	// the node group launches replacements.
+	EnterStandby(ctx context.Context, decrement bool, instanceIDs []string, groupName string, logger *logrus.Entry) error
+	// ExitStandby returns the instances to service, incrementing the desired
+	// capacity of the node group.
+	ExitStandby(ctx context.Context, instanceIDs []string, groupName string, logger *logrus.Entry) error
+	// TerminateNodes terminates the instances.
+	TerminateNodes(ctx context.Context, instanceIDs []string, logger *logrus.Entry) error
+	// SuspendProcesses suspends the processes of the node group.
+	SuspendProcesses(ctx context.Context, groupName string, processes []string, logger *logrus.Entry) error
+	// ResumeProcesses resumes the suspended processes of the node group.
+	ResumeProcesses(ctx context.Context, groupName string, processes []string, logger *logrus.Entry) error
+	// WaitForCapacity waits until the node group has the desired number of
+	// instances, not counting the ones in standby.
+	WaitForCapacity(ctx context.Context, groupName string, desiredCapacity int, logger *logrus.Entry) (*NodeGroup, error)
+	// SetCapacity changes the desired capacity and max size of the node group.
+	SetCapacity(ctx context.Context, groupName string, desiredCapacity, maxSize int, logger *logrus.Entry) error
+}
@@ -3,8 +3,11 @@ package model
 import (
 	"encoding/json"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 // RotateClusterRequest specifies the parameters for a new cluster rotation.
@@ -18,6 +21,58 @@ type RotateClusterRequest struct {
 	WaitBetweenRotations    int    `json:"waitBetweenRotations,omitempty"`
 	WaitBetweenDrains       int    `json:"waitBetweenDrains,omitempty"`
 	WaitBetweenPodEvictions int    `json:"waitBetweenPodEvictions,omitempty"`
+	DryRun                  bool   `json:"dryRun,omitempty"`
+	DriftOnly               bool   `json:"driftOnly,omitempty"`
+	DriftCompareImage       bool   `json:"driftCompareImage,omitempty"`
+	DriftCompareType        bool   `json:"driftCompareType,omitempty"`
+	MaxNodeAge              string `json:"maxNodeAge,omitempty"`
+	Strategy                string `json:"strategy,omitempty"`
+	Standby                 bool   `json:"standby,omitempty"`
+	FailurePolicy           string `json:"failurePolicy,omitempty"`
+	// AutoscalingGroups, if set, are the names of the autoscaling groups of
+	// the cluster, overriding their discovery by tags.
+	AutoscalingGroups []string `json:"autoscalingGroups,omitempty"`
+	ClusterTagKeys    []string `json:"clusterTagKeys,omitempty"`
+	MasterTagKey      string   `json:"masterTagKey,omitempty"`
+	// IncludeAutoscalingGroups, ExcludeAutoscalingGroups, Nodes and
+	// LabelSelector narrow the rotation to some autoscaling groups and nodes.
+	// Nodes must match all of them to be rotated.
+	IncludeAutoscalingGroups []string `json:"includeAutoscalingGroups,omitempty"`
+	ExcludeAutoscalingGroups []string `json:"excludeAutoscalingGroups,omitempty"`
+	Nodes                    []string `json:"nodes,omitempty"`
+	LabelSelector            string   `json:"labelSelector,omitempty"`
+	// ParallelGroups is the number of worker autoscaling groups rotated at
+	// once. Masters are always rotated one group at a time.
+	ParallelGroups int `json:"parallelGroups,omitempty"`
+	// MaxDrainingNodes caps the number of nodes drained at once across the
+	// autoscaling groups. Zero means no cap.
+	MaxDrainingNodes int `json:"maxDrainingNodes,omitempty"`
+	// SuspendAZRebalance suspends the AZRebalance process of autoscaling
+	// groups while they are rotated.
+	SuspendAZRebalance bool `json:"suspendAZRebalance,omitempty"`
+	// SuspendProcesses are the processes of autoscaling groups suspended
+	// while they are rotated: AZRebalance, ReplaceUnhealthy or ScheduledActions.
+	SuspendProcesses []string `json:"suspendProcesses,omitempty"`
+	// DisableScaleDown keeps cluster-autoscaler from scaling down the nodes
+	// being rotated.
+	DisableScaleDown bool `json:"disableScaleDown,omitempty"`
+	// PDBPolicy decides whether batches of nodes whose pods cannot be
+	// evicted because of PodDisruptionBudgets are drained anyway, delayed or
+	// refused. PDBWaitTimeout is how long they are delayed at most.
+	PDBPolicy      string `json:"pdbPolicy,omitempty"`
+	PDBWaitTimeout string `json:"pdbWaitTimeout,omitempty"`
+	// EvictByPriority and EvictionNamespaceTiers order the eviction of the
+	// pods of each node, see ValidateEvictionNamespaceTiers.
+	EvictByPriority        bool       `json:"evictByPriority,omitempty"`
+	EvictionNamespaceTiers [][]string `json:"evictionNamespaceTiers,omitempty"`
+	// CompletionTimeout is how long pods annotated to be waited for are
+	// waited for, and CompletionPolicy what happens to those that do not
+	// complete in time.
+	CompletionTimeout string `json:"completionTimeout,omitempty"`
+	CompletionPolicy  string `json:"completionPolicy,omitempty"`
+	// MaxConcurrentEvictions is how many pods of each node are evicted at
+	// once. Defaults to DefaultMaxConcurrentEvictions.
+	MaxConcurrentEvictions int `json:"maxConcurrentEvictions,omitempty"`
 }
 
 // NewRotateClusterRequestFromReader decodes the request and returns after validation and setting the defaults.
@@ -67,8 +122,177 @@ func (request *RotateClusterRequest) Validate() error {
 		return errors.New("Wait between pod evictions cannot be negative")
 	}
 
+	if request.ParallelGroups < 0 {
+		return errors.New("Parallel groups cannot be negative")
+	}
+
+	if request.MaxDrainingNodes < 0 {
+		return errors.New("Max draining nodes cannot be negative")
+	}
+
+	if !request.DriftOnly && (request.DriftCompareImage || request.DriftCompareType) {
+		return errors.New("Drift comparisons can only be set in drift only mode")
+	}
+
+	if request.MaxNodeAge != "" {
+		maxNodeAge, err := time.ParseDuration(request.MaxNodeAge)
+		if err != nil {
+			return errors.Wrap(err, "Max node age is not a valid duration")
+		}
+		if maxNodeAge <= 0 {
+			return errors.New("Max node age must be positive")
+		}
+	}
+
+	switch request.Strategy {
+	case "", RotationStrategyDetach, RotationStrategySurge:
+	default:
+		return errors.Errorf("Strategy must be %s or %s", RotationStrategyDetach, RotationStrategySurge)
+	}
+
+	switch request.FailurePolicy {
+	case "", FailurePolicyAbort, FailurePolicyRollback, FailurePolicyContinue:
+	default:
+		return errors.Errorf("Failure policy must be %s, %s or %s", FailurePolicyAbort, FailurePolicyRollback, FailurePolicyContinue)
+	}
+
+	switch request.PDBPolicy {
+	case "", PDBPolicyIgnore, PDBPolicyWait, PDBPolicyRefuse:
+	default:
+		return errors.Errorf("PDB policy must be %s, %s or %s", PDBPolicyIgnore, PDBPolicyWait, PDBPolicyRefuse)
+	}
+
+	if request.PDBWaitTimeout != "" {
+		pdbWaitTimeout, err := time.ParseDuration(request.PDBWaitTimeout)
+		if err != nil {
+			return errors.Wrap(err, "PDB wait timeout is not a valid duration")
+		}
+		if pdbWaitTimeout <= 0 {
+			return errors.New("PDB wait timeout must be positive")
+		}
+	}
+
+	err := ValidateEvictionNamespaceTiers(request.EvictionNamespaceTiers)
+	if err != nil {
+		return err
+	}
+
+	err = validateCompletion(request.CompletionTimeout, request.CompletionPolicy)
+	if err != nil {
+		return err
+	}
+
+	if request.MaxConcurrentEvictions < 0 {
+		return errors.New("Max concurrent evictions cannot be negative")
+	}
+
+	for _, name := range request.AutoscalingGroups {
+		if name == "" {
+			return errors.New("Autoscaling group names cannot be empty")
+		}
+	}
+
+	for _, key := range request.ClusterTagKeys {
+		if key == "" {
+			return errors.New("Cluster tag keys cannot be empty")
+		}
+	}
+
+	for _, name := range request.IncludeAutoscalingGroups {
+		for _, excluded := range request.ExcludeAutoscalingGroups {
+			if name == excluded {
+				return errors.Errorf("Autoscaling group %s cannot be both included and excluded", name)
+			}
+		}
+	}
+
+	for _, node := range request.Nodes {
+		if node == "" {
+			return errors.New("Node names cannot be empty")
+		}
+	}
+
+	for _, process := range request.SuspendProcesses {
+		if !containsString(SuspendableProcesses, process) {
+			return errors.Errorf("Suspend processes must be %s", strings.Join(SuspendableProcesses, ", "))
+		}
+	}
+
+	if request.LabelSelector != "" {
+		_, err := labels.Parse(request.LabelSelector)
+		if err != nil {
+			return errors.Wrap(err, "Label selector is not valid")
+		}
+	}
+
 	return nil
 }
 
+// ToCluster returns the cluster to rotate as requested.
+func (request *RotateClusterRequest) ToCluster() *Cluster {
+	return &Cluster{
+		ClusterID:                request.ClusterID,
+		MaxScaling:               request.MaxScaling,
+		RotateMasters:            request.RotateMasters,
+		RotateWorkers:            request.RotateWorkers,
+		MaxDrainRetries:          request.MaxDrainRetries,
+		EvictGracePeriod:         request.EvictGracePeriod,
+		WaitBetweenRotations:     request.WaitBetweenRotations,
+		WaitBetweenDrains:        request.WaitBetweenDrains,
+		WaitBetweenPodEvictions:  request.WaitBetweenPodEvictions,
+		DriftOnly:                request.DriftOnly,
+		DriftCompareImage:        request.DriftCompareImage,
+		DriftCompareType:         request.DriftCompareType,
+		MaxNodeAge:               request.GetMaxNodeAge(),
+		Strategy:                 request.Strategy,
+		Standby:                  request.Standby,
+		FailurePolicy:            request.FailurePolicy,
+		AutoscalingGroups:        request.AutoscalingGroups,
+		ClusterTagKeys:           request.ClusterTagKeys,
+		MasterTagKey:             request.MasterTagKey,
+		IncludeAutoscalingGroups: request.IncludeAutoscalingGroups,
+		ExcludeAutoscalingGroups: request.ExcludeAutoscalingGroups,
+		Nodes:                    request.Nodes,
+		LabelSelector:            request.LabelSelector,
+		ParallelGroups:           request.ParallelGroups,
+		MaxDrainingNodes:         request.MaxDrainingNodes,
+		SuspendAZRebalance:       request.SuspendAZRebalance,
+		SuspendProcesses:         request.SuspendProcesses,
+		DisableScaleDown:         request.DisableScaleDown,
+		PDBPolicy:                request.PDBPolicy,
+		PDBWaitTimeout:           request.GetPDBWaitTimeout(),
+		EvictByPriority:          request.EvictByPriority,
+		EvictionNamespaceTiers:   request.EvictionNamespaceTiers,
+		CompletionTimeout:        request.GetCompletionTimeout(),
+		CompletionPolicy:         request.CompletionPolicy,
+		MaxConcurrentEvictions:   request.MaxConcurrentEvictions,
+	}
+}
+
+// GetMaxNodeAge returns the max node age of the request, or zero if not set.
+func (request *RotateClusterRequest) GetMaxNodeAge() time.Duration {
+	maxNodeAge, _ := time.ParseDuration(request.MaxNodeAge)
+	return maxNodeAge
+}
+
+// GetPDBWaitTimeout returns the PDB wait timeout of the request, or zero if not set.
+func (request *RotateClusterRequest) GetPDBWaitTimeout() time.Duration {
+	pdbWaitTimeout, _ := time.ParseDuration(request.PDBWaitTimeout)
+	return pdbWaitTimeout
+}
+
+// GetCompletionTimeout returns the completion timeout of the request, or zero if not set.
+func (request *RotateClusterRequest) GetCompletionTimeout() time.Duration {
+	completionTimeout, _ := time.ParseDuration(request.CompletionTimeout)
+	return completionTimeout
+}
+
 // SetDefaults sets the default values for a cluster provision request.
-func (request *RotateClusterRequest) SetDefaults() {}
+func (request *RotateClusterRequest) SetDefaults() {
+	if request.ParallelGroups == 0 {
+		request.ParallelGroups = 1
+	}
+	if request.Strategy == "" {
+		request.Strategy = RotationStrategyDetach
+	}
+}
@@ -0,0 +1,120 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule launches cluster rotations periodically, within a maintenance window.
+type Schedule struct {
+	ID        string
+	ClusterID string
+	Cron      string
+	Window    string
+	Rotation  RotateClusterRequest
+	CreateAt  int64
+	// NextRunAt is when the next rotation is due. A due rotation is launched
+	// as soon as the maintenance window is open.
+	NextRunAt int64
+	LastJobID string
+	// PausedByWindow is true when the last job was paused because the
+	// maintenance window closed, and is resumed when it opens again.
+	PausedByWindow bool `json:",omitempty"`
+}
+
+// ScheduleRequest specifies the parameters of a new or updated schedule.
+type ScheduleRequest struct {
+	Cron     string               `json:"cron,omitempty"`
+	Window   string               `json:"window,omitempty"`
+	Rotation RotateClusterRequest `json:"rotation"`
+}
+
+// NewScheduleRequestFromReader decodes the request and returns after validation.
+func NewScheduleRequestFromReader(reader io.Reader) (*ScheduleRequest, error) {
+	var scheduleRequest ScheduleRequest
+	err := json.NewDecoder(reader).Decode(&scheduleRequest)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode schedule request")
+	}
+
+	err = scheduleRequest.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "schedule request failed validation")
+	}
+	scheduleRequest.Rotation.SetDefaults()
+
+	return &scheduleRequest, nil
+}
+
+// Validate validates the values of a schedule request.
+func (request *ScheduleRequest) Validate() error {
+	_, err := ParseCron(request.Cron)
+	if err != nil {
+		return err
+	}
+
+	if request.Window != "" {
+		_, err = ParseMaintenanceWindow(request.Window)
+		if err != nil {
+			return err
+		}
+	}
+
+	if request.Rotation.DryRun {
+		return errors.New("Scheduled rotations cannot be dry runs")
+	}
+
+	return request.Rotation.Validate()
+}
+
+// ParseCron parses a standard five field cron expression, such as "0 3 * * 2".
+func ParseCron(expression string) (cron.Schedule, error) {
+	if expression == "" {
+		return nil, errors.New("Cron expression cannot be empty")
+	}
+
+	schedule, err := cron.ParseStandard(expression)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid cron expression %q", expression)
+	}
+
+	return schedule, nil
+}
+
+// NextRun returns when the schedule is due after the given time.
+func (s *Schedule) NextRun(after time.Time) (time.Time, error) {
+	schedule, err := ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return schedule.Next(after), nil
+}
+
+// ScheduleFromReader decodes a json-encoded schedule from the given io.Reader.
+func ScheduleFromReader(reader io.Reader) (*Schedule, error) {
+	schedule := Schedule{}
+	decoder := json.NewDecoder(reader)
+	err := decoder.Decode(&schedule)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// SchedulesFromReader decodes a json-encoded list of schedules from the given io.Reader.
+func SchedulesFromReader(reader io.Reader) ([]*Schedule, error) {
+	schedules := []*Schedule{}
+	decoder := json.NewDecoder(reader)
+	err := decoder.Decode(&schedules)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return schedules, nil
+}
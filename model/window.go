@@ -0,0 +1,166 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// MaintenanceWindow is a recurring period of time during which changes are allowed.
+type MaintenanceWindow struct {
+	// days are the weekdays on which the window opens.
+	days [7]bool
+	// start and end are offsets from midnight. A window ending before it
+	// starts closes on the following day.
+	start    time.Duration
+	end      time.Duration
+	location *time.Location
+}
+
+// ParseMaintenanceWindow parses a window such as "Tue-Thu 02:00-05:00 UTC".
+// The days are a comma separated list of weekdays and weekday ranges, and
+// default to every day. The time zone is an IANA time zone name and defaults
+// to UTC.
+func ParseMaintenanceWindow(window string) (*MaintenanceWindow, error) {
+	fields := strings.Fields(window)
+	if len(fields) == 0 || len(fields) > 3 {
+		return nil, errors.Errorf("invalid maintenance window %q, expected \"[days] HH:MM-HH:MM [time zone]\"", window)
+	}
+
+	parsed := &MaintenanceWindow{location: time.UTC}
+
+	// The times are the only field containing a colon.
+	timesIndex := -1
+	for i, field := range fields {
+		if strings.Contains(field, ":") {
+			timesIndex = i
+			break
+		}
+	}
+	if timesIndex < 0 || timesIndex > 1 {
+		return nil, errors.Errorf("invalid maintenance window %q, expected \"[days] HH:MM-HH:MM [time zone]\"", window)
+	}
+
+	if timesIndex == 1 {
+		err := parsed.parseDays(fields[0])
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for day := range parsed.days {
+			parsed.days[day] = true
+		}
+	}
+
+	times := strings.Split(fields[timesIndex], "-")
+	if len(times) != 2 {
+		return nil, errors.Errorf("invalid maintenance window times %q, expected HH:MM-HH:MM", fields[timesIndex])
+	}
+	var err error
+	parsed.start, err = parseTimeOfDay(times[0])
+	if err != nil {
+		return nil, err
+	}
+	parsed.end, err = parseTimeOfDay(times[1])
+	if err != nil {
+		return nil, err
+	}
+	if parsed.start == parsed.end {
+		return nil, errors.Errorf("maintenance window %q is empty", window)
+	}
+
+	if len(fields) > timesIndex+1 {
+		parsed.location, err = time.LoadLocation(fields[timesIndex+1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid maintenance window time zone %q", fields[timesIndex+1])
+		}
+	}
+
+	return parsed, nil
+}
+
+// parseDays parses a comma separated list of weekdays and weekday ranges.
+func (w *MaintenanceWindow) parseDays(days string) error {
+	for _, part := range strings.Split(days, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return errors.Errorf("invalid maintenance window days %q", part)
+		}
+
+		first, ok := weekdays[strings.ToLower(bounds[0])]
+		if !ok {
+			return errors.Errorf("invalid maintenance window day %q", bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, ok = weekdays[strings.ToLower(bounds[1])]
+			if !ok {
+				return errors.Errorf("invalid maintenance window day %q", bounds[1])
+			}
+		}
+
+		// Ranges such as Fri-Mon wrap around the end of the week.
+		for day := first; ; day = (day + 1) % 7 {
+			w.days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseTimeOfDay parses a HH:MM time into an offset from midnight.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, errors.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil || hours < 0 || hours > 24 {
+		return 0, errors.Errorf("invalid hours in time %q", value)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 || (hours == 24 && minutes != 0) {
+		return 0, errors.Errorf("invalid minutes in time %q", value)
+	}
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// Contains returns true if the window is open at the given time.
+func (w *MaintenanceWindow) Contains(t time.Time) bool {
+	t = t.In(w.location)
+
+	// The window may have opened today or, if it crosses midnight, yesterday.
+	for _, daysAgo := range []int{0, 1} {
+		day := t.AddDate(0, 0, -daysAgo)
+		if !w.days[day.Weekday()] {
+			continue
+		}
+		midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, w.location)
+		opens := midnight.Add(w.start)
+		closes := midnight.Add(w.end)
+		if w.end < w.start {
+			closes = closes.AddDate(0, 0, 1)
+		}
+		if !t.Before(opens) && t.Before(closes) {
+			return true
+		}
+	}
+
+	return false
+}
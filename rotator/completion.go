@@ -0,0 +1,197 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/rotator/model"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// SkipEvictionAnnotation, set to "true" on a pod or its namespace, keeps
+	// the pod from being evicted by drains. It is left to stop with its node.
+	SkipEvictionAnnotation = "rotator.mattermost.com/skip-eviction"
+	// WaitForCompletionAnnotation, set to "true" on a pod or its namespace,
+	// makes drains wait for the pod to complete instead of evicting it.
+	WaitForCompletionAnnotation = "rotator.mattermost.com/wait-for-completion"
+
+	kSkipEvictionWarning      = "Not evicting pods annotated with " + SkipEvictionAnnotation
+	kWaitForCompletionWarning = "Waiting for the completion of pods annotated with " + WaitForCompletionAnnotation
+)
+
+// CompletionPollInterval is how often the pods a drain waits for are checked.
+var CompletionPollInterval = 10 * time.Second
+
+// podAnnotations tells whether pods opted out of eviction, through their own
+// annotations or those of their namespace. Annotations of pods take
+// precedence over those of their namespace.
+type podAnnotations struct {
+	ctx        context.Context
+	client     typedcorev1.NamespaceInterface
+	namespaces map[string]map[string]string
+}
+
+func newPodAnnotations(ctx context.Context, client kubernetes.Interface) *podAnnotations {
+	return &podAnnotations{
+		ctx:        ctx,
+		client:     client.CoreV1().Namespaces(),
+		namespaces: make(map[string]map[string]string),
+	}
+}
+
+// enabled returns true if the annotation is set to true on the pod, or on its
+// namespace if the pod does not have it.
+func (a *podAnnotations) enabled(pod corev1.Pod, annotation string) (bool, error) {
+	value, found := pod.Annotations[annotation]
+	if !found {
+		namespaceAnnotations, cached := a.namespaces[pod.Namespace]
+		if !cached {
+			namespace, err := a.client.Get(a.ctx, pod.Namespace, metav1.GetOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return false, errors.Wrapf(err, "failed to get namespace %s", pod.Namespace)
+			}
+			if err == nil {
+				namespaceAnnotations = namespace.Annotations
+			}
+			a.namespaces[pod.Namespace] = namespaceAnnotations
+		}
+		value, found = namespaceAnnotations[annotation]
+	}
+	if !found {
+		return false, nil
+	}
+
+	enabled, _ := strconv.ParseBool(value)
+	return enabled, nil
+}
+
+// evictionFilter excludes from eviction the pods annotated to be skipped or waited for.
+func (a *podAnnotations) evictionFilter(pod corev1.Pod) (bool, *warning, *fatal) {
+	// any finished pod can be removed
+	if podFinished(pod) {
+		return true, nil, nil
+	}
+
+	skip, err := a.enabled(pod, SkipEvictionAnnotation)
+	if err != nil {
+		return false, nil, &fatal{err.Error()}
+	}
+	if skip {
+		return false, &warning{kSkipEvictionWarning}, nil
+	}
+
+	wait, err := a.enabled(pod, WaitForCompletionAnnotation)
+	if err != nil {
+		return false, nil, &fatal{err.Error()}
+	}
+	if wait {
+		return false, &warning{kWaitForCompletionWarning}, nil
+	}
+
+	return true, nil, nil
+}
+
+func podFinished(pod corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+// getPodsToWaitFor returns the pods of the node annotated to be waited for
+// that did not complete yet.
+func getPodsToWaitFor(ctx context.Context, client kubernetes.Interface, node *corev1.Node, options *DrainOptions) ([]corev1.Pod, error) {
+	listOptions := metav1.ListOptions{
+		FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": node.Name}).String(),
+	}
+	if options.Selector != nil {
+		listOptions.LabelSelector = options.Selector.String()
+	}
+	podList, err := client.CoreV1().Pods(options.Namespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := newPodAnnotations(ctx, client)
+	var pods []corev1.Pod
+	for _, pod := range podList.Items {
+		if podFinished(pod) {
+			continue
+		}
+		skip, err := annotations.enabled(pod, SkipEvictionAnnotation)
+		if err != nil {
+			return nil, err
+		}
+		if skip {
+			continue
+		}
+		wait, err := annotations.enabled(pod, WaitForCompletionAnnotation)
+		if err != nil {
+			return nil, err
+		}
+		if wait {
+			pods = append(pods, pod)
+		}
+	}
+
+	return pods, nil
+}
+
+// completionTimeoutError is returned when pods waited for do not complete in
+// time. Draining the node again would not help, so it is not retried.
+type completionTimeoutError struct {
+	pods    string
+	timeout time.Duration
+}
+
+func (e *completionTimeoutError) Error() string {
+	return fmt.Sprintf("pods %s did not complete within %s", e.pods, e.timeout)
+}
+
+// isRetryableDrainError returns true if draining the node again may succeed.
+func isRetryableDrainError(err error) bool {
+	var timeoutErr *completionTimeoutError
+	return !errors.As(err, &timeoutErr)
+}
+
+// waitForCompletion waits for the pods of the node annotated to be waited for
+// to complete. Once the completion timeout elapses, the drain fails or the
+// pods are evicted, depending on the completion policy.
+func waitForCompletion(ctx context.Context, client kubernetes.Interface, node *corev1.Node, options *DrainOptions, waitBetweenPodEvictions int, logger *logrus.Entry) error {
+	timeout := options.CompletionTimeout
+	if timeout <= 0 {
+		timeout = model.DefaultCompletionTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		pods, err := getPodsToWaitFor(ctx, client, node, options)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get the pods to wait for on node %s", node.Name)
+		}
+		if len(pods) == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			if options.CompletionPolicy == model.CompletionPolicyEvict {
+				logger.Warnf("Pods %s did not complete within %s, evicting them", podNames(pods), timeout)
+				return deleteOrEvictPods(ctx, client, pods, options, waitBetweenPodEvictions, logger)
+			}
+			return &completionTimeoutError{pods: podNames(pods), timeout: timeout}
+		}
+
+		logger.Infof("Waiting for pods %s to complete...", podNames(pods))
+		err = sleep(ctx, CompletionPollInterval)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -6,14 +6,15 @@ import (
 	"math"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	awsTools "github.com/mattermost/rotator/aws"
 	k8sTools "github.com/mattermost/rotator/k8s"
 	"github.com/mattermost/rotator/model"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
@@ -23,10 +24,11 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/kubernetes"
 	typedappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
-	typedpolicyv1beta1 "k8s.io/client-go/kubernetes/typed/policy/v1beta1"
 )
 
 type DrainOptions struct {
@@ -63,6 +65,30 @@ type DrainOptions struct {
 	// option is appropriate; examples include the Node is unready and the pods
 	// won't drain otherwise
 	SkipWaitForDeleteTimeoutSeconds int
+
+	// EvictByPriority evicts the pods of lower priority before those of
+	// higher priority.
+	EvictByPriority bool
+
+	// NamespaceTiers evicts the pods of the namespaces of each tier after
+	// those of the tiers before it. Pods of namespaces in no tier go first.
+	NamespaceTiers [][]string
+
+	// CompletionTimeout is how long the pods annotated to be waited for are
+	// waited for. Defaults to model.DefaultCompletionTimeout.
+	CompletionTimeout time.Duration
+
+	// CompletionPolicy decides whether the drain fails or the pods are
+	// evicted once the completion timeout elapses.
+	CompletionPolicy string
+
+	// MaxConcurrentEvictions is how many pods are evicted at once. Defaults
+	// to model.DefaultMaxConcurrentEvictions.
+	MaxConcurrentEvictions int
+
+	// OnEvictionBlocked is called when the eviction of a pod is refused
+	// because of the PodDisruptionBudgets covering it.
+	OnEvictionBlocked func(pod *corev1.Pod, pdbs []policyv1.PodDisruptionBudget)
 }
 
 type waitForDeleteParams struct {
@@ -99,92 +125,126 @@ const (
 	kUnmanagedWarning    = "Deleting pods not managed by ReplicationController, ReplicaSet, Job, DaemonSet or StatefulSet"
 )
 
-// InitDrainNode is used to call the Drain function.
-func InitDrainNode(nodeDrain *model.NodeDrain, logger *logrus.Entry) error {
-	ctx := context.TODO()
-
-	drainOptions := &DrainOptions{
+// newDrainOptions returns the drain options used for node rotations and drains.
+func newDrainOptions(gracePeriod int) *DrainOptions {
+	return &DrainOptions{
 		DeleteLocalData:    true,
 		IgnoreDaemonsets:   true,
 		Timeout:            600,
-		GracePeriodSeconds: nodeDrain.GracePeriod,
+		GracePeriodSeconds: gracePeriod,
 	}
+}
+
+// clusterDrainOptions returns the drain options used for the nodes of a cluster rotation.
+func clusterDrainOptions(cluster *model.Cluster) *DrainOptions {
+	drainOptions := newDrainOptions(cluster.EvictGracePeriod)
+	drainOptions.EvictByPriority = cluster.EvictByPriority
+	drainOptions.NamespaceTiers = cluster.EvictionNamespaceTiers
+	drainOptions.CompletionTimeout = cluster.CompletionTimeout
+	drainOptions.CompletionPolicy = cluster.CompletionPolicy
+	drainOptions.MaxConcurrentEvictions = cluster.MaxConcurrentEvictions
 
-	clientSet, err := k8sTools.GetClientset()
+	return drainOptions
+}
+
+// InitDrainNode is used to call the Drain function.
+func InitDrainNode(nodeDrain *model.NodeDrain, logger *logrus.Entry) error {
+	return InitDrainNodeWithContext(context.Background(), nodeDrain, logger)
+}
+
+// InitDrainNodeWithContext is used to call the Drain function. The drain stops
+// at the next safe point once the context is cancelled.
+func InitDrainNodeWithContext(ctx context.Context, nodeDrain *model.NodeDrain, logger *logrus.Entry) (err error) {
+	drainOptions := newDrainOptions(nodeDrain.GracePeriod)
+	drainOptions.EvictByPriority = nodeDrain.EvictByPriority
+	drainOptions.NamespaceTiers = nodeDrain.EvictionNamespaceTiers
+	drainOptions.CompletionTimeout = nodeDrain.CompletionTimeout
+	drainOptions.CompletionPolicy = nodeDrain.CompletionPolicy
+	drainOptions.MaxConcurrentEvictions = nodeDrain.MaxConcurrentEvictions
+
+	clientSet, err := getk8sClientset(nodeDrain.ClientSet)
 	if err != nil {
 		return err
 	}
 
-	if nodeDrain.DetachNode {
-		asgs, errASG := awsTools.GetAutoscalingGroups(nodeDrain.ClusterID)
+	provider := getProvider(nodeDrain.Provider)
+
+	// standbyGroup is the autoscaling group the node was put in standby in,
+	// until the node is drained. A failed drain returns the node to service.
+	var standbyGroup string
+	defer func() {
+		if err == nil || standbyGroup == "" {
+			return
+		}
+		rollbackErr := rollbackStandby([]string{nodeDrain.NodeName}, standbyGroup, clientSet, provider, logger)
+		if rollbackErr != nil {
+			logger.WithError(rollbackErr).Errorf("Failed to return node %s to service", nodeDrain.NodeName)
+		}
+	}()
+
+	if nodeDrain.DetachNode || nodeDrain.StandbyNode {
+		nodeGroups, errASG := provider.GetNodeGroups(ctx, &model.NodeGroupSelector{
+			ClusterID:      nodeDrain.ClusterID,
+			ClusterTagKeys: nodeDrain.ClusterTagKeys,
+		})
 		if errASG != nil {
-			return errors.Wrapf(err, "Failed to get autoscaling groups for cluster %s", nodeDrain.ClusterID)
+			return errors.Wrapf(errASG, "Failed to get autoscaling groups for cluster %s", nodeDrain.ClusterID)
 		}
 		var instanceID string
-		instanceID, err = awsTools.GetInstanceID(nodeDrain.NodeName, logger)
+		instanceID, err = k8sTools.ResolveInstanceID(ctx, nodeDrain.NodeName, clientSet, provider, logger)
 		if err != nil {
 			return errors.Wrapf(err, "Failed to get instance ID for node %s", nodeDrain.NodeName)
 		}
 		var nodeFound bool
-		var nodeInGroup bool
-		for _, asg := range asgs {
-			nodeInGroup, err = awsTools.NodeInAutoscalingGroup(*asg.AutoScalingGroupName, instanceID)
-			if err != nil {
-				return errors.Wrapf(err, "Failed to check if node %s belongs in autoscaling group %s", nodeDrain.NodeName, *asg.AutoScalingGroupName)
-			}
-			if nodeInGroup {
+		for _, nodeGroup := range nodeGroups {
+			if instanceID != "" && nodeGroup.HasInstance(instanceID) {
 				nodeFound = true
-				logger.Infof("Node %s is in autoscaling group %s", nodeDrain.NodeName, *asg.AutoScalingGroupName)
-				logger.Infof("Detaching node %s from autoscaling group %s", nodeDrain.NodeName, *asg.AutoScalingGroupName)
-				err = awsTools.DetachNodes(false, []string{nodeDrain.NodeName}, *asg.AutoScalingGroupName, logger)
+				logger.Infof("Node %s is in autoscaling group %s", nodeDrain.NodeName, nodeGroup.Name)
+				if nodeDrain.StandbyNode {
+					logger.Infof("Putting node %s in standby in autoscaling group %s", nodeDrain.NodeName, nodeGroup.Name)
+					err = provider.EnterStandby(ctx, false, []string{instanceID}, nodeGroup.Name, logger)
+					if err != nil {
+						return errors.Wrapf(err, "Failed to put node %s in standby in autoscaling group %s", nodeDrain.NodeName, nodeGroup.Name)
+					}
+					standbyGroup = nodeGroup.Name
+					continue
+				}
+				logger.Infof("Detaching node %s from autoscaling group %s", nodeDrain.NodeName, nodeGroup.Name)
+				err = provider.DetachNodes(ctx, false, []string{instanceID}, nodeGroup.Name, logger)
 				if err != nil {
-					return errors.Wrapf(err, "Failed to detach node %s from autoscaling group %s", nodeDrain.NodeName, *asg.AutoScalingGroupName)
+					return errors.Wrapf(err, "Failed to detach node %s from autoscaling group %s", nodeDrain.NodeName, nodeGroup.Name)
 				}
-				logger.Infof("Detaching node %s from autoscaling group %s successful", nodeDrain.NodeName, *asg.AutoScalingGroupName)
+				logger.Infof("Detaching node %s from autoscaling group %s successful", nodeDrain.NodeName, nodeGroup.Name)
 			}
 		}
 		if !nodeFound {
 			logger.Infof("Node %s not found in any autoscaling group, assuming it is detached...", nodeDrain.NodeName)
 		}
 
-		logger.Info("Sleeping 60 seconds for autoscaling group to balance...")
-		time.Sleep(60 * time.Second)
+		logger.Infof("Sleeping %s for autoscaling group to balance...", BalanceWait)
+		err = sleep(ctx, BalanceWait)
+		if err != nil {
+			return err
+		}
 	}
 
 	logger.Infof("Draining node %s", nodeDrain.NodeName)
 
-	node, err := clientSet.CoreV1().Nodes().Get(ctx, nodeDrain.NodeName, metav1.GetOptions{})
-	privateIP, _ := awsTools.ExtractPrivateIP(nodeDrain.NodeName)
-	instanceID, _ := awsTools.GetInstanceIDByPrivateIP(privateIP)
+	// The node and its instance may be named differently, so the node is
+	// removed by the name it is known by.
+	k8sName := nodeDrain.NodeName
 
+	node, err := k8sTools.GetNode(ctx, nodeDrain.NodeName, clientSet, provider, logger)
 	if k8sErrors.IsNotFound(err) {
-		node1, err1 := clientSet.CoreV1().Nodes().Get(ctx, instanceID, metav1.GetOptions{})
-		if err1 == nil {
-			for _, condition := range node1.Status.Conditions {
-				if condition.Reason == "KubeletReady" && condition.Status == corev1.ConditionTrue {
-					err = Drain(clientSet, []*corev1.Node{node1}, drainOptions, nodeDrain.WaitBetweenPodEvictions, logger)
-					logger.Infof("Draining node using instance ID %s", node1.Name)
-					for i := 1; i < nodeDrain.MaxDrainRetries && err != nil; i++ {
-						logger.Warnf("Failed to drain node %q on attempt %d, retrying up to %d times", nodeDrain.NodeName, i, nodeDrain.MaxDrainRetries)
-						err = Drain(clientSet, []*corev1.Node{node1}, drainOptions, nodeDrain.WaitBetweenPodEvictions, logger)
-					}
-					if err != nil {
-						return errors.Wrapf(err, "Failed to drain node %s", node1.Name)
-					}
-					logger.Infof("Node %s drained", node1.Name)
-				} else if condition.Reason == "KubeletReady" && condition.Status == corev1.ConditionFalse {
-					logger.Infof("Node %s found but not ready, waiting...", node1)
-				}
-			}
-		}
 		logger.Warnf("Node %s not found, assuming already drained", nodeDrain.NodeName)
 	} else if err != nil {
 		return errors.Wrapf(err, "Failed to get node %s", nodeDrain.NodeName)
 	} else {
-		err = Drain(clientSet, []*corev1.Node{node}, drainOptions, nodeDrain.WaitBetweenPodEvictions, logger)
-		for i := 1; i < nodeDrain.MaxDrainRetries && err != nil; i++ {
+		k8sName = node.Name
+		err = Drain(ctx, clientSet, []*corev1.Node{node}, drainOptions, nodeDrain.WaitBetweenPodEvictions, logger)
+		for i := 1; i < nodeDrain.MaxDrainRetries && err != nil && ctx.Err() == nil && isRetryableDrainError(err); i++ {
 			logger.Warnf("Failed to drain node %q on attempt %d, retrying up to %d times", nodeDrain.NodeName, i, nodeDrain.MaxDrainRetries)
-			err = Drain(clientSet, []*corev1.Node{node}, drainOptions, nodeDrain.WaitBetweenPodEvictions, logger)
+			err = Drain(ctx, clientSet, []*corev1.Node{node}, drainOptions, nodeDrain.WaitBetweenPodEvictions, logger)
 		}
 		if err != nil {
 			return errors.Wrapf(err, "Failed to drain node %s", nodeDrain.NodeName)
@@ -192,9 +252,20 @@ func InitDrainNode(nodeDrain *model.NodeDrain, logger *logrus.Entry) error {
 		logger.Infof("Node %s drained", nodeDrain.NodeName)
 	}
 
+	// The node is drained, so it is no longer returned to service on failure.
+	standbyGroup = ""
+
 	if nodeDrain.TerminateNode {
+		if ctx.Err() != nil {
+			return errors.Wrapf(ctx.Err(), "Stopped before terminating node %s", nodeDrain.NodeName)
+		}
+
 		logger.Infof("Terminating node %s ", nodeDrain.NodeName)
-		err3 := awsTools.TerminateNodes([]string{nodeDrain.NodeName}, logger)
+		instanceIDs, err3 := resolveInstanceIDs(ctx, []string{k8sName}, clientSet, provider, logger)
+		if err3 != nil {
+			return errors.Wrapf(err3, "Failed to terminate node %s", nodeDrain.NodeName)
+		}
+		err3 = provider.TerminateNodes(ctx, instanceIDs, logger)
 		if err3 != nil {
 			return errors.Wrapf(err3, "Failed to terminate node %s", nodeDrain.NodeName)
 		}
@@ -202,7 +273,7 @@ func InitDrainNode(nodeDrain *model.NodeDrain, logger *logrus.Entry) error {
 
 		logger.Infof("Removing node %s from k8s", nodeDrain.NodeName)
 
-		err = k8sTools.DeleteClusterNodes([]string{nodeDrain.NodeName}, clientSet, logger)
+		err = k8sTools.DeleteClusterNodes(ctx, []string{k8sName}, clientSet, logger)
 		if err != nil {
 			return err
 		}
@@ -214,20 +285,28 @@ func InitDrainNode(nodeDrain *model.NodeDrain, logger *logrus.Entry) error {
 	return nil
 }
 
-func Drain(client kubernetes.Interface, nodes []*corev1.Node, options *DrainOptions, waitBetweenPodEvictions int, logger *logrus.Entry) error {
+// Drain cordons the given nodes and evicts or deletes their pods. If the context
+// is cancelled before a node is fully drained, the node is uncordoned again,
+// unless it was already cordoned before the drain.
+func Drain(ctx context.Context, client kubernetes.Interface, nodes []*corev1.Node, options *DrainOptions, waitBetweenPodEvictions int, logger *logrus.Entry) error {
 	nodeInterface := client.CoreV1().Nodes()
+	cordonedNodes := sets.NewString()
 	for _, node := range nodes {
-		err := Cordon(nodeInterface, node, logger)
+		if node.Spec.Unschedulable {
+			continue
+		}
+		err := Cordon(ctx, nodeInterface, node, logger)
 		if err != nil {
 			return err
 		}
+		cordonedNodes.Insert(node.Name)
 	}
 
 	drainedNodes := sets.NewString()
 	var fatal error
 
 	for _, node := range nodes {
-		err := DeleteOrEvictPods(client, node, options, waitBetweenPodEvictions, logger)
+		err := DeleteOrEvictPods(ctx, client, node, options, waitBetweenPodEvictions, logger)
 		if err == nil {
 			drainedNodes.Insert(node.Name)
 			logger.Infof("Drained node %q", node.Name)
@@ -249,20 +328,47 @@ func Drain(client kubernetes.Interface, nodes []*corev1.Node, options *DrainOpti
 		}
 	}
 
+	if fatal != nil && ctx.Err() != nil {
+		uncordonUndrainedNodes(nodeInterface, nodes, cordonedNodes, drainedNodes, logger)
+	}
+
 	return fatal
 }
 
+// uncordonUndrainedNodes makes the nodes cordoned by the drain that were not
+// fully drained schedulable again.
+func uncordonUndrainedNodes(client typedcorev1.NodeInterface, nodes []*corev1.Node, cordonedNodes, drainedNodes sets.String, logger *logrus.Entry) {
+	// The drain context is already cancelled, so a fresh one is needed to undo the cordon.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, node := range nodes {
+		if !cordonedNodes.Has(node.Name) || drainedNodes.Has(node.Name) {
+			continue
+		}
+		cordoned := node.DeepCopy()
+		cordoned.Spec.Unschedulable = true
+		err := Uncordon(ctx, client, cordoned, logger)
+		if err != nil {
+			logger.WithError(err).Errorf("Failed to uncordon node %q", node.Name)
+		}
+	}
+}
+
 // DeleteOrEvictPods deletes or (where supported) evicts pods from the
 // target node and waits until the deletion/eviction completes,
 // Timeout elapses, or an error occurs.
-func DeleteOrEvictPods(client kubernetes.Interface, node *corev1.Node, options *DrainOptions, waitBetweenPodEvictions int, logger *logrus.Entry) error {
-	pods, err := getPodsForDeletion(client, node, options, logger)
+func DeleteOrEvictPods(ctx context.Context, client kubernetes.Interface, node *corev1.Node, options *DrainOptions, waitBetweenPodEvictions int, logger *logrus.Entry) error {
+	pods, err := getPodsForDeletion(ctx, client, node, options, logger)
 	if err != nil {
 		return err
 	}
-	err = deleteOrEvictPods(client, pods, options, waitBetweenPodEvictions, logger)
-	if err != nil {
-		pendingPods, newErr := getPodsForDeletion(client, node, options, logger)
+	err = deleteOrEvictPods(ctx, client, pods, options, waitBetweenPodEvictions, logger)
+	if err == nil {
+		err = waitForCompletion(ctx, client, node, options, waitBetweenPodEvictions, logger)
+	}
+	if err != nil && ctx.Err() == nil {
+		pendingPods, newErr := getPodsForDeletion(ctx, client, node, options, logger)
 		if newErr != nil {
 			return newErr
 		}
@@ -298,14 +404,13 @@ func (o *DrainOptions) unreplicatedFilter(pod corev1.Pod) (bool, *warning, *fata
 }
 
 type DaemonSetFilterOptions struct {
+	ctx              context.Context
 	client           typedappsv1.AppsV1Interface
 	force            bool
 	ignoreDaemonSets bool
 }
 
 func (o *DaemonSetFilterOptions) daemonSetFilter(pod corev1.Pod) (bool, *warning, *fatal) {
-	ctx := context.TODO()
-
 	// Note that we return false in cases where the pod is DaemonSet managed,
 	// regardless of flags.  We never delete them, the only question is whether
 	// their presence constitutes an error.
@@ -318,7 +423,7 @@ func (o *DaemonSetFilterOptions) daemonSetFilter(pod corev1.Pod) (bool, *warning
 		return true, nil, nil
 	}
 
-	if _, err := o.client.DaemonSets(pod.Namespace).Get(ctx, controllerRef.Name, metav1.GetOptions{}); err != nil {
+	if _, err := o.client.DaemonSets(pod.Namespace).Get(o.ctx, controllerRef.Name, metav1.GetOptions{}); err != nil {
 		// remove orphaned pods with a warning if Force is used
 		if apierrors.IsNotFound(err) && o.force {
 			return true, &warning{err.Error()}, nil
@@ -374,9 +479,7 @@ func (ps podStatuses) message() string {
 
 // getPodsForDeletion receives resource info for a node, and returns all the pods from the given node that we
 // are planning on deleting. If there are any pods preventing us from deleting, we return that list in an error.
-func getPodsForDeletion(client kubernetes.Interface, node *corev1.Node, options *DrainOptions, logger *logrus.Entry) ([]corev1.Pod, error) {
-	ctx := context.TODO()
-
+func getPodsForDeletion(ctx context.Context, client kubernetes.Interface, node *corev1.Node, options *DrainOptions, logger *logrus.Entry) ([]corev1.Pod, error) {
 	listOptions := metav1.ListOptions{
 		FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": node.Name}).String(),
 	}
@@ -392,15 +495,18 @@ func getPodsForDeletion(client kubernetes.Interface, node *corev1.Node, options
 	fs := podStatuses{}
 
 	daemonSetOptions := &DaemonSetFilterOptions{
+		ctx:              ctx,
 		client:           client.AppsV1(),
 		force:            options.Force,
 		ignoreDaemonSets: options.IgnoreDaemonsets,
 	}
 
+	annotations := newPodAnnotations(ctx, client)
+
 	var pods []corev1.Pod
 	for _, pod := range podList.Items {
 		podOk := true
-		for _, filt := range []podFilter{daemonSetOptions.daemonSetFilter, mirrorPodFilter, options.localStorageFilter, options.unreplicatedFilter} {
+		for _, filt := range []podFilter{daemonSetOptions.daemonSetFilter, mirrorPodFilter, annotations.evictionFilter, options.localStorageFilter, options.unreplicatedFilter} {
 			filterOk, w, f := filt(pod)
 
 			podOk = podOk && filterOk
@@ -432,32 +538,8 @@ func getPodsForDeletion(client kubernetes.Interface, node *corev1.Node, options
 	return pods, nil
 }
 
-func evictPod(client typedpolicyv1beta1.PolicyV1beta1Interface, pod corev1.Pod, policyGroupVersion string, gracePeriodSeconds int) error {
-	ctx := context.TODO()
-
-	deleteOptions := &metav1.DeleteOptions{}
-	if gracePeriodSeconds >= 0 {
-		gracePeriod := int64(gracePeriodSeconds)
-		deleteOptions.GracePeriodSeconds = &gracePeriod
-	}
-	eviction := &policyv1beta1.Eviction{
-		TypeMeta: metav1.TypeMeta{
-			APIVersion: policyGroupVersion,
-			Kind:       EvictionKind,
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      pod.Name,
-			Namespace: pod.Namespace,
-		},
-		DeleteOptions: deleteOptions,
-	}
-	return client.Evictions(eviction.Namespace).Evict(ctx, eviction)
-}
-
 // deleteOrEvictPods deletes or evicts the pods on the api server
-func deleteOrEvictPods(client kubernetes.Interface, pods []corev1.Pod, options *DrainOptions, waitBetweenPodEvictions int, logger *logrus.Entry) error {
-	ctx := context.TODO()
-
+func deleteOrEvictPods(ctx context.Context, client kubernetes.Interface, pods []corev1.Pod, options *DrainOptions, waitBetweenPodEvictions int, logger *logrus.Entry) error {
 	if len(pods) == 0 {
 		return nil
 	}
@@ -466,20 +548,41 @@ func deleteOrEvictPods(client kubernetes.Interface, pods []corev1.Pod, options *
 		return client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
 	}
 
-	policyGroupVersion, err := SupportEviction(client)
+	evictor, err := newEvictor(client)
 	if err != nil {
 		return err
 	}
 
-	if len(policyGroupVersion) > 0 {
-		// Remember to change the URL manipulation func when Evction's version change
-		return evictPods(client.PolicyV1beta1(), pods, policyGroupVersion, options, getPodFn, waitBetweenPodEvictions, logger)
+	getBlockingPDBsFn := func(pod corev1.Pod) ([]policyv1.PodDisruptionBudget, error) {
+		return getBlockingPDBs(ctx, client, []corev1.Pod{pod})
+	}
+
+	if evictor != nil {
+		logger.Infof("Evicting %d pods with the %s eviction API", len(pods), evictor.groupVersion())
+	} else {
+		logger.Infof("Eviction is not supported, deleting %d pods", len(pods))
 	}
-	return deletePods(client.CoreV1(), pods, options, getPodFn, waitBetweenPodEvictions)
+
+	// Each tier is evicted, and its pods deleted, before the next one starts.
+	tiers := options.evictionTiers(pods, logger)
+	for i, tier := range tiers {
+		if len(tiers) > 1 {
+			logger.Infof("Evicting tier %d of %d: %s", i+1, len(tiers), podNames(tier))
+		}
+		if evictor != nil {
+			err = evictPods(ctx, evictor, tier, options, getPodFn, getBlockingPDBsFn, waitBetweenPodEvictions, logger)
+		} else {
+			err = deletePods(ctx, client.CoreV1(), tier, options, getPodFn, waitBetweenPodEvictions)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func evictPods(client typedpolicyv1beta1.PolicyV1beta1Interface, pods []corev1.Pod, policyGroupVersion string, options *DrainOptions, getPodFn func(namespace, name string) (*corev1.Pod, error), waitBetweenPodEvictions int, logger *logrus.Entry) error {
-	returnCh := make(chan error, 1)
+func evictPods(ctx context.Context, evictor evictor, pods []corev1.Pod, options *DrainOptions, getPodFn func(namespace, name string) (*corev1.Pod, error), getBlockingPDBsFn func(pod corev1.Pod) ([]policyv1.PodDisruptionBudget, error), waitBetweenPodEvictions int, logger *logrus.Entry) error {
 	// 0 timeout means infinite, we use MaxInt64 to represent it.
 	var globalTimeout time.Duration
 	if options.Timeout == 0 {
@@ -487,74 +590,133 @@ func evictPods(client typedpolicyv1beta1.PolicyV1beta1Interface, pods []corev1.P
 	} else {
 		globalTimeout = options.Timeout * time.Second
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), globalTimeout)
+	ctx, cancel := context.WithTimeout(ctx, globalTimeout)
 	defer cancel()
-	for _, pod := range pods {
-		time.Sleep(time.Duration(waitBetweenPodEvictions) * time.Second)
-		go func(pod corev1.Pod, returnCh chan error) {
-			for {
-				logger.Infof("Evicting pod %s/%s\n", pod.Namespace, pod.Name)
-				select {
-				case <-ctx.Done():
-					// return here or we'll leak a goroutine.
-					returnCh <- fmt.Errorf("Error when evicting pod %q: global timeout reached: %v", pod.Name, globalTimeout)
-					return
-				default:
-				}
-				err := evictPod(client, pod, policyGroupVersion, options.GracePeriodSeconds)
-				if err == nil {
-					break
-				} else if apierrors.IsNotFound(err) {
-					returnCh <- nil
-					return
-				} else if apierrors.IsTooManyRequests(err) {
-					logger.Errorf("Error when evicting pod %q (will retry after 5s): %v\n", pod.Name, err)
-					time.Sleep(5 * time.Second)
-				} else {
-					returnCh <- fmt.Errorf("Error when evicting pod %q: %v", pod.Name, err)
-					return
+
+	workers := options.MaxConcurrentEvictions
+	if workers <= 0 {
+		workers = model.DefaultMaxConcurrentEvictions
+	}
+	if workers > len(pods) {
+		workers = len(pods)
+	}
+
+	podCh := make(chan corev1.Pod)
+	// returnCh holds the result of every pod so that workers never block on it.
+	returnCh := make(chan error, len(pods))
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pod := range podCh {
+				evictionsInFlight.Add(1)
+				err := evictPod(ctx, evictor, pod, options, getPodFn, getBlockingPDBsFn, globalTimeout, logger)
+				evictionsInFlight.Add(-1)
+				if err != nil {
+					evictionFailuresTotal.Add(1)
 				}
+				returnCh <- err
 			}
-			logger.Infof("Pod %s/%s evicted\n", pod.Namespace, pod.Name)
-			params := waitForDeleteParams{
-				ctx:                             ctx,
-				pods:                            []corev1.Pod{pod},
-				interval:                        1 * time.Second,
-				timeout:                         time.Duration(math.MaxInt64),
-				usingEviction:                   true,
-				getPodFn:                        getPodFn,
-				onDoneFn:                        options.OnPodDeletedOrEvicted,
-				globalTimeout:                   globalTimeout,
-				skipWaitForDeleteTimeoutSeconds: options.SkipWaitForDeleteTimeoutSeconds,
-			}
-			_, err := waitForDelete(params)
-			if err == nil {
-				returnCh <- nil
-			} else {
-				returnCh <- fmt.Errorf("Error when waiting for pod %q terminating: %v", pod.Name, err)
-			}
-		}(pod, returnCh)
+		}()
 	}
 
-	doneCount := 0
+	for _, pod := range pods {
+		err := sleep(ctx, time.Duration(waitBetweenPodEvictions)*time.Second)
+		if err != nil {
+			returnCh <- fmt.Errorf("Error when evicting pod %q: %v", pod.Name, err)
+			continue
+		}
+		podCh <- pod
+	}
+	close(podCh)
+	wg.Wait()
+	close(returnCh)
+
 	var errors []error
+	for err := range returnCh {
+		if err != nil {
+			errors = append(errors, err)
+		}
+	}
 
-	numPods := len(pods)
-	for doneCount < numPods {
-		select {
-		case err := <-returnCh:
-			doneCount++
-			if err != nil {
-				errors = append(errors, err)
+	return utilerrors.NewAggregate(errors)
+}
+
+// evictPod evicts the pod and waits for it to be deleted. Evictions refused
+// with 429 Too Many Requests are retried with exponential backoff.
+func evictPod(ctx context.Context, evictor evictor, pod corev1.Pod, options *DrainOptions, getPodFn func(namespace, name string) (*corev1.Pod, error), getBlockingPDBsFn func(pod corev1.Pod) ([]policyv1.PodDisruptionBudget, error), globalTimeout time.Duration, logger *logrus.Entry) error {
+	backoff := wait.Backoff{
+		Duration: EvictionBackoffInitial,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      EvictionBackoffMax,
+	}
+	// The PodDisruptionBudgets blocking the eviction are looked up the first
+	// time it is refused.
+	var blockingPDBs []policyv1.PodDisruptionBudget
+	blockingPDBsKnown := false
+	logger.Infof("Evicting pod %s/%s", pod.Namespace, pod.Name)
+	for {
+		if ctx.Err() != nil {
+			return fmt.Errorf("Error when evicting pod %q: %v", pod.Name, ctx.Err())
+		}
+		err := evictor.evict(ctx, pod, options.GracePeriodSeconds)
+		if err == nil {
+			break
+		} else if apierrors.IsNotFound(err) {
+			return nil
+		} else if !apierrors.IsTooManyRequests(err) {
+			return fmt.Errorf("Error when evicting pod %q: %v", pod.Name, err)
+		}
+
+		evictionRetriesTotal.Add(1)
+		if !blockingPDBsKnown {
+			blockingPDBsKnown = true
+			var pdbErr error
+			blockingPDBs, pdbErr = getBlockingPDBsFn(pod)
+			if pdbErr != nil {
+				logger.WithError(pdbErr).Warnf("Failed to get the PodDisruptionBudgets of pod %s/%s", pod.Namespace, pod.Name)
+			}
+			if len(blockingPDBs) > 0 && options.OnEvictionBlocked != nil {
+				options.OnEvictionBlocked(&pod, blockingPDBs)
 			}
-		default:
+		}
+		delay := backoff.Step()
+		if len(blockingPDBs) > 0 {
+			logger.Errorf("Eviction of pod %s/%s blocked by PodDisruptionBudget(s) %s (will retry after %s)", pod.Namespace, pod.Name, pdbNames(blockingPDBs), delay.Round(time.Millisecond))
+		} else {
+			logger.Errorf("Error when evicting pod %q (will retry after %s): %v", pod.Name, delay.Round(time.Millisecond), err)
+		}
+		err = sleep(ctx, delay)
+		if err != nil {
+			return fmt.Errorf("Error when evicting pod %q: %v", pod.Name, err)
 		}
 	}
+	evictionsTotal.Add(1)
+	logger.Infof("Pod %s/%s evicted", pod.Namespace, pod.Name)
 
-	return utilerrors.NewAggregate(errors)
+	params := waitForDeleteParams{
+		ctx:                             ctx,
+		pods:                            []corev1.Pod{pod},
+		interval:                        1 * time.Second,
+		timeout:                         time.Duration(math.MaxInt64),
+		usingEviction:                   true,
+		getPodFn:                        getPodFn,
+		onDoneFn:                        options.OnPodDeletedOrEvicted,
+		globalTimeout:                   globalTimeout,
+		skipWaitForDeleteTimeoutSeconds: options.SkipWaitForDeleteTimeoutSeconds,
+	}
+	_, err := waitForDelete(params)
+	if err != nil {
+		return fmt.Errorf("Error when waiting for pod %q terminating: %v", pod.Name, err)
+	}
+
+	return nil
 }
 
-func deletePods(client typedcorev1.CoreV1Interface, pods []corev1.Pod, options *DrainOptions, getPodFn func(namespace, name string) (*corev1.Pod, error), waitBetweenPodEvictions int) error {
+func deletePods(ctx context.Context, client typedcorev1.CoreV1Interface, pods []corev1.Pod, options *DrainOptions, getPodFn func(namespace, name string) (*corev1.Pod, error), waitBetweenPodEvictions int) error {
 	// 0 timeout means infinite, we use MaxInt64 to represent it.
 	var globalTimeout time.Duration
 	if options.Timeout == 0 {
@@ -563,14 +725,16 @@ func deletePods(client typedcorev1.CoreV1Interface, pods []corev1.Pod, options *
 		globalTimeout = options.Timeout * time.Second
 	}
 	for _, pod := range pods {
-		time.Sleep(time.Duration(waitBetweenPodEvictions) * time.Second)
-		err := DeletePod(client, pod)
+		err := sleep(ctx, time.Duration(waitBetweenPodEvictions)*time.Second)
+		if err != nil {
+			return err
+		}
+		err = DeletePod(ctx, client, pod)
 		if err != nil && !apierrors.IsNotFound(err) {
 			return err
 		}
 	}
 
-	ctx := context.Background()
 	params := waitForDeleteParams{
 		ctx:                             ctx,
 		pods:                            pods,
@@ -587,8 +751,8 @@ func deletePods(client typedcorev1.CoreV1Interface, pods []corev1.Pod, options *
 }
 
 // DeletePod will delete the given pod, or return an error if it couldn't
-func DeletePod(client typedcorev1.CoreV1Interface, pod corev1.Pod) error {
-	return client.Pods(pod.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{})
+func DeletePod(ctx context.Context, client typedcorev1.CoreV1Interface, pod corev1.Pod) error {
+	return client.Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
 }
 
 func waitForDelete(params waitForDeleteParams) ([]corev1.Pod, error) {
@@ -596,6 +760,8 @@ func waitForDelete(params waitForDeleteParams) ([]corev1.Pod, error) {
 	timeout := time.After(params.timeout)
 	for {
 		select {
+		case <-params.ctx.Done():
+			return pods, params.ctx.Err()
 		case <-timeout:
 			return pods, fmt.Errorf("Timeout reached: %v", params.timeout)
 		default:
@@ -620,30 +786,25 @@ func waitForDelete(params waitForDeleteParams) ([]corev1.Pod, error) {
 			if len(pendingPods) == 0 {
 				return pods, nil
 			}
-			time.Sleep(params.interval)
+			err := sleep(params.ctx, params.interval)
+			if err != nil {
+				return pods, err
+			}
 		}
 	}
 }
 
 // SupportEviction uses Discovery API to find out if the server
 // supports the eviction subresource.  If supported, it will return
-// its groupVersion; otherwise it will return an empty string.
+// the groupVersion to evict with, policy/v1 if served and policy/v1beta1
+// otherwise; if not, it will return an empty string.
 func SupportEviction(clientset kubernetes.Interface) (string, error) {
 	discoveryClient := clientset.Discovery()
-	groupList, err := discoveryClient.ServerGroups()
+	policyGroupVersion, err := servedPolicyGroupVersion(discoveryClient)
 	if err != nil {
 		return "", err
 	}
-	foundPolicyGroup := false
-	var policyGroupVersion string
-	for _, group := range groupList.Groups {
-		if group.Name == "policy" {
-			foundPolicyGroup = true
-			policyGroupVersion = group.PreferredVersion.GroupVersion
-			break
-		}
-	}
-	if !foundPolicyGroup {
+	if policyGroupVersion == "" {
 		return "", nil
 	}
 	resourceList, err := discoveryClient.ServerResourcesForGroupVersion("v1")
@@ -658,19 +819,45 @@ func SupportEviction(clientset kubernetes.Interface) (string, error) {
 	return "", nil
 }
 
+// servedPolicyGroupVersion returns the most recent version of the policy API
+// group the server serves, policy/v1 or policy/v1beta1, or an empty string if
+// it serves neither.
+func servedPolicyGroupVersion(discoveryClient discovery.DiscoveryInterface) (string, error) {
+	groupList, err := discoveryClient.ServerGroups()
+	if err != nil {
+		return "", err
+	}
+	var policyGroupVersion string
+	for _, group := range groupList.Groups {
+		if group.Name != policyv1.GroupName {
+			continue
+		}
+		for _, version := range group.Versions {
+			switch version.GroupVersion {
+			case policyv1.SchemeGroupVersion.String():
+				policyGroupVersion = version.GroupVersion
+			case policyv1beta1.SchemeGroupVersion.String():
+				if policyGroupVersion == "" {
+					policyGroupVersion = version.GroupVersion
+				}
+			}
+		}
+	}
+
+	return policyGroupVersion, nil
+}
+
 // Cordon marks a node "Unschedulable".  This method is idempotent.
-func Cordon(client typedcorev1.NodeInterface, node *corev1.Node, logger *logrus.Entry) error {
-	return cordonOrUncordon(client, node, true, logger)
+func Cordon(ctx context.Context, client typedcorev1.NodeInterface, node *corev1.Node, logger *logrus.Entry) error {
+	return cordonOrUncordon(ctx, client, node, true, logger)
 }
 
 // Uncordon marks a node "Schedulable".  This method is idempotent.
-func Uncordon(client typedcorev1.NodeInterface, node *corev1.Node, logger *logrus.Entry) error {
-	return cordonOrUncordon(client, node, false, logger)
+func Uncordon(ctx context.Context, client typedcorev1.NodeInterface, node *corev1.Node, logger *logrus.Entry) error {
+	return cordonOrUncordon(ctx, client, node, false, logger)
 }
 
-func cordonOrUncordon(client typedcorev1.NodeInterface, node *corev1.Node, desired bool, logger *logrus.Entry) error {
-	ctx := context.TODO()
-
+func cordonOrUncordon(ctx context.Context, client typedcorev1.NodeInterface, node *corev1.Node, desired bool, logger *logrus.Entry) error {
 	unsched := node.Spec.Unschedulable
 	if unsched == desired {
 		return nil
@@ -687,3 +874,41 @@ func cordonOrUncordon(client typedcorev1.NodeInterface, node *corev1.Node, desir
 	}
 	return err
 }
+
+const (
+	// ScaleDownDisabledAnnotation keeps cluster-autoscaler from scaling a node down.
+	ScaleDownDisabledAnnotation = "cluster-autoscaler.kubernetes.io/scale-down-disabled"
+	// scaleDownDisabledByRotatorAnnotation marks the nodes whose scale-down
+	// was disabled by the rotator, so that it is only enabled again on those.
+	scaleDownDisabledByRotatorAnnotation = "rotator.mattermost.com/scale-down-disabled"
+)
+
+// DisableScaleDown annotates a node so that cluster-autoscaler does not scale
+// it down. Nodes whose scale-down is already disabled are left unchanged.
+func DisableScaleDown(ctx context.Context, client typedcorev1.NodeInterface, node *corev1.Node, logger *logrus.Entry) error {
+	if _, found := node.Annotations[ScaleDownDisabledAnnotation]; found {
+		return nil
+	}
+
+	patch := []byte(fmt.Sprintf("{\"metadata\":{\"annotations\":{%q:\"true\",%q:\"true\"}}}", ScaleDownDisabledAnnotation, scaleDownDisabledByRotatorAnnotation))
+	_, err := client.Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err == nil {
+		logger.Infof("disabled scale-down of node %q", node.Name)
+	}
+	return err
+}
+
+// EnableScaleDown removes the annotations set by DisableScaleDown. Nodes
+// whose scale-down was not disabled by the rotator are left unchanged.
+func EnableScaleDown(ctx context.Context, client typedcorev1.NodeInterface, node *corev1.Node, logger *logrus.Entry) error {
+	if _, found := node.Annotations[scaleDownDisabledByRotatorAnnotation]; !found {
+		return nil
+	}
+
+	patch := []byte(fmt.Sprintf("{\"metadata\":{\"annotations\":{%q:null,%q:null}}}", ScaleDownDisabledAnnotation, scaleDownDisabledByRotatorAnnotation))
+	_, err := client.Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err == nil {
+		logger.Infof("enabled scale-down of node %q", node.Name)
+	}
+	return err
+}
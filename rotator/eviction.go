@@ -0,0 +1,194 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	typedpolicyv1 "k8s.io/client-go/kubernetes/typed/policy/v1"
+	typedpolicyv1beta1 "k8s.io/client-go/kubernetes/typed/policy/v1beta1"
+)
+
+// EvictionOrderAnnotation orders the eviction of the pods of a node. Pods are
+// evicted by increasing value, before the other eviction orders apply, and
+// pods without it have an order of 0.
+const EvictionOrderAnnotation = "rotator.mattermost.com/eviction-order"
+
+// EvictionBackoffInitial and EvictionBackoffMax bound the exponential backoff
+// between the retries of an eviction refused with 429 Too Many Requests.
+var (
+	EvictionBackoffInitial = 5 * time.Second
+	EvictionBackoffMax     = 2 * time.Minute
+)
+
+// evictor evicts pods through a version of the eviction API.
+type evictor interface {
+	// evict evicts the pod, giving it the grace period to terminate. A
+	// negative grace period uses the default of the pod.
+	evict(ctx context.Context, pod corev1.Pod, gracePeriodSeconds int) error
+	// groupVersion returns the policy group version evictions are made with.
+	groupVersion() string
+}
+
+// policyV1Evictor evicts pods with the policy/v1 eviction API, served since Kubernetes 1.22.
+type policyV1Evictor struct {
+	client typedpolicyv1.PolicyV1Interface
+}
+
+func (e *policyV1Evictor) evict(ctx context.Context, pod corev1.Pod, gracePeriodSeconds int) error {
+	eviction := &policyv1.Eviction{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: e.groupVersion(),
+			Kind:       EvictionKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+		DeleteOptions: evictionDeleteOptions(gracePeriodSeconds),
+	}
+	return e.client.Evictions(eviction.Namespace).Evict(ctx, eviction)
+}
+
+func (e *policyV1Evictor) groupVersion() string {
+	return policyv1.SchemeGroupVersion.String()
+}
+
+// policyV1beta1Evictor evicts pods with the policy/v1beta1 eviction API,
+// removed in Kubernetes 1.25.
+type policyV1beta1Evictor struct {
+	client typedpolicyv1beta1.PolicyV1beta1Interface
+}
+
+func (e *policyV1beta1Evictor) evict(ctx context.Context, pod corev1.Pod, gracePeriodSeconds int) error {
+	eviction := &policyv1beta1.Eviction{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: e.groupVersion(),
+			Kind:       EvictionKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+		DeleteOptions: evictionDeleteOptions(gracePeriodSeconds),
+	}
+	return e.client.Evictions(eviction.Namespace).Evict(ctx, eviction)
+}
+
+func (e *policyV1beta1Evictor) groupVersion() string {
+	return policyv1beta1.SchemeGroupVersion.String()
+}
+
+// evictionDeleteOptions returns the options deleting an evicted pod.
+func evictionDeleteOptions(gracePeriodSeconds int) *metav1.DeleteOptions {
+	deleteOptions := &metav1.DeleteOptions{}
+	if gracePeriodSeconds >= 0 {
+		gracePeriod := int64(gracePeriodSeconds)
+		deleteOptions.GracePeriodSeconds = &gracePeriod
+	}
+
+	return deleteOptions
+}
+
+// newEvictor returns an evictor for the most recent eviction API the server
+// supports, or nil if it does not support evictions.
+func newEvictor(clientset kubernetes.Interface) (evictor, error) {
+	policyGroupVersion, err := SupportEviction(clientset)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to discover the eviction API")
+	}
+
+	switch policyGroupVersion {
+	case "":
+		return nil, nil
+	case policyv1.SchemeGroupVersion.String():
+		return &policyV1Evictor{client: clientset.PolicyV1()}, nil
+	case policyv1beta1.SchemeGroupVersion.String():
+		return &policyV1beta1Evictor{client: clientset.PolicyV1beta1()}, nil
+	}
+
+	return nil, errors.Errorf("unsupported eviction API %s", policyGroupVersion)
+}
+
+// evictionTier identifies the pods evicted together.
+type evictionTier struct {
+	order         int
+	namespaceTier int
+	priority      int32
+}
+
+// before returns true if the pods of the tier are evicted before those of the other tier.
+func (t evictionTier) before(other evictionTier) bool {
+	if t.order != other.order {
+		return t.order < other.order
+	}
+	if t.namespaceTier != other.namespaceTier {
+		return t.namespaceTier < other.namespaceTier
+	}
+
+	return t.priority < other.priority
+}
+
+// evictionTiers splits the pods in the tiers they are evicted in: by
+// eviction order annotation, then by namespace tier, then by priority if
+// enabled. Pods are all in a single tier otherwise.
+func (o *DrainOptions) evictionTiers(pods []corev1.Pod, logger *logrus.Entry) [][]corev1.Pod {
+	namespaceTiers := make(map[string]int)
+	for i, tier := range o.NamespaceTiers {
+		for _, namespace := range tier {
+			// Pods of namespaces in no tier are evicted first.
+			namespaceTiers[namespace] = i + 1
+		}
+	}
+
+	podsByTier := make(map[evictionTier][]corev1.Pod)
+	var tiers []evictionTier
+	for _, pod := range pods {
+		tier := evictionTier{namespaceTier: namespaceTiers[pod.Namespace]}
+		if value, found := pod.Annotations[EvictionOrderAnnotation]; found {
+			order, err := strconv.Atoi(value)
+			if err != nil {
+				logger.Warnf("Ignoring invalid %s annotation %q of pod %s/%s", EvictionOrderAnnotation, value, pod.Namespace, pod.Name)
+			}
+			tier.order = order
+		}
+		if o.EvictByPriority && pod.Spec.Priority != nil {
+			tier.priority = *pod.Spec.Priority
+		}
+
+		if _, found := podsByTier[tier]; !found {
+			tiers = append(tiers, tier)
+		}
+		podsByTier[tier] = append(podsByTier[tier], pod)
+	}
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].before(tiers[j])
+	})
+
+	var tieredPods [][]corev1.Pod
+	for _, tier := range tiers {
+		tieredPods = append(tieredPods, podsByTier[tier])
+	}
+
+	return tieredPods
+}
+
+// podNames returns the comma-separated namespaced names of the pods.
+func podNames(pods []corev1.Pod) string {
+	var names []string
+	for _, pod := range pods {
+		names = append(names, fmt.Sprintf("%s/%s", pod.Namespace, pod.Name))
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,202 @@
+package rotator
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newPolicyClientset returns a fake clientset whose discovery serves the
+// given versions of the policy API group and whose evictions always succeed.
+func newPolicyClientset(policyGroupVersions ...string) *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	resources := []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Kind: "Pod", Namespaced: true},
+				{Name: "pods/eviction", Kind: "Eviction", Namespaced: true},
+			},
+		},
+	}
+	for _, groupVersion := range policyGroupVersions {
+		resources = append(resources, &metav1.APIResourceList{
+			GroupVersion: groupVersion,
+			APIResources: []metav1.APIResource{
+				{Name: "poddisruptionbudgets", Kind: "PodDisruptionBudget", Namespaced: true},
+			},
+		})
+	}
+	clientset.Discovery().(*fakediscovery.FakeDiscovery).Resources = resources
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return action.(k8stesting.CreateAction).GetSubresource() == "eviction", nil, nil
+	})
+
+	return clientset
+}
+
+func TestNewEvictor(t *testing.T) {
+	tests := []struct {
+		name                 string
+		policyGroupVersions  []string
+		expectedGroupVersion string
+		expectedEviction     runtime.Object
+	}{
+		{
+			name:                 "policy/v1 only",
+			policyGroupVersions:  []string{"policy/v1"},
+			expectedGroupVersion: "policy/v1",
+			expectedEviction:     &policyv1.Eviction{},
+		},
+		{
+			name:                 "policy/v1beta1 only",
+			policyGroupVersions:  []string{"policy/v1beta1"},
+			expectedGroupVersion: "policy/v1beta1",
+			expectedEviction:     &policyv1beta1.Eviction{},
+		},
+		{
+			name:                 "both, policy/v1 wins",
+			policyGroupVersions:  []string{"policy/v1beta1", "policy/v1"},
+			expectedGroupVersion: "policy/v1",
+			expectedEviction:     &policyv1.Eviction{},
+		},
+		{
+			name:                 "neither",
+			policyGroupVersions:  nil,
+			expectedGroupVersion: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := newPolicyClientset(test.policyGroupVersions...)
+
+			groupVersion, err := SupportEviction(clientset)
+			if err != nil {
+				t.Fatalf("SupportEviction failed: %v", err)
+			}
+			if groupVersion != test.expectedGroupVersion {
+				t.Fatalf("SupportEviction returned %q, expected %q", groupVersion, test.expectedGroupVersion)
+			}
+
+			evictor, err := newEvictor(clientset)
+			if err != nil {
+				t.Fatalf("newEvictor failed: %v", err)
+			}
+			if test.expectedGroupVersion == "" {
+				if evictor != nil {
+					t.Fatalf("expected no evictor, got one for %s", evictor.groupVersion())
+				}
+				return
+			}
+			if evictor.groupVersion() != test.expectedGroupVersion {
+				t.Fatalf("evictor uses %s, expected %s", evictor.groupVersion(), test.expectedGroupVersion)
+			}
+
+			pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod1"}}
+			err = evictor.evict(context.Background(), pod, 30)
+			if err != nil {
+				t.Fatalf("evict failed: %v", err)
+			}
+
+			var evictions []runtime.Object
+			for _, action := range clientset.Actions() {
+				createAction, ok := action.(k8stesting.CreateAction)
+				if ok && createAction.GetSubresource() == "eviction" {
+					evictions = append(evictions, createAction.GetObject())
+				}
+			}
+			if len(evictions) != 1 {
+				t.Fatalf("expected 1 eviction, got %d", len(evictions))
+			}
+			switch eviction := evictions[0].(type) {
+			case *policyv1.Eviction:
+				if _, ok := test.expectedEviction.(*policyv1.Eviction); !ok {
+					t.Fatalf("evicted with policy/v1, expected %s", test.expectedGroupVersion)
+				}
+				if eviction.APIVersion != test.expectedGroupVersion || eviction.Name != pod.Name || *eviction.DeleteOptions.GracePeriodSeconds != 30 {
+					t.Fatalf("unexpected eviction %+v", eviction)
+				}
+			case *policyv1beta1.Eviction:
+				if _, ok := test.expectedEviction.(*policyv1beta1.Eviction); !ok {
+					t.Fatalf("evicted with policy/v1beta1, expected %s", test.expectedGroupVersion)
+				}
+				if eviction.APIVersion != test.expectedGroupVersion || eviction.Name != pod.Name || *eviction.DeleteOptions.GracePeriodSeconds != 30 {
+					t.Fatalf("unexpected eviction %+v", eviction)
+				}
+			default:
+				t.Fatalf("unexpected eviction object %T", eviction)
+			}
+		})
+	}
+}
+
+func TestGetBlockingPDBs(t *testing.T) {
+	labels := map[string]string{"app": "db"}
+	pods := []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db-0", Labels: labels}}}
+	selector := &metav1.LabelSelector{MatchLabels: labels}
+
+	tests := []struct {
+		name                string
+		policyGroupVersions []string
+		objects             []runtime.Object
+		expectedPDBs        int
+	}{
+		{
+			name:                "policy/v1",
+			policyGroupVersions: []string{"policy/v1", "policy/v1beta1"},
+			objects: []runtime.Object{&policyv1.PodDisruptionBudget{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"},
+				Spec:       policyv1.PodDisruptionBudgetSpec{Selector: selector},
+			}},
+			expectedPDBs: 1,
+		},
+		{
+			name:                "policy/v1beta1",
+			policyGroupVersions: []string{"policy/v1beta1"},
+			objects: []runtime.Object{&policyv1beta1.PodDisruptionBudget{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"},
+				Spec:       policyv1beta1.PodDisruptionBudgetSpec{Selector: selector},
+			}},
+			expectedPDBs: 1,
+		},
+		{
+			name:                "neither",
+			policyGroupVersions: nil,
+			expectedPDBs:        0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := newPolicyClientset(test.policyGroupVersions...)
+			for _, object := range test.objects {
+				err := clientset.Tracker().Add(object)
+				if err != nil {
+					t.Fatalf("failed to add %T: %v", object, err)
+				}
+			}
+
+			pdbs, err := getBlockingPDBs(context.Background(), clientset, pods)
+			if err != nil {
+				t.Fatalf("getBlockingPDBs failed: %v", err)
+			}
+			if len(pdbs) != test.expectedPDBs {
+				t.Fatalf("got %d blocking PodDisruptionBudgets, expected %d", len(pdbs), test.expectedPDBs)
+			}
+			for _, pdb := range pdbs {
+				if pdb.Namespace != "default" || pdb.Name != "db" {
+					t.Fatalf("unexpected PodDisruptionBudget %s/%s", pdb.Namespace, pdb.Name)
+				}
+			}
+		})
+	}
+}
@@ -2,21 +2,33 @@ package rotator
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go/service/autoscaling"
 	awsTools "github.com/mattermost/rotator/aws"
 	k8sTools "github.com/mattermost/rotator/k8s"
 	"github.com/mattermost/rotator/model"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+// sleep pauses for the given duration or until the context is cancelled.
+func sleep(ctx context.Context, duration time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(duration):
+		return nil
+	}
+}
+
 // newNodes separates old nodes from new in a provided slice and returns new.
 func newNodes(allNodes, oldNodes []string) []string {
 	mb := make(map[string]struct{}, len(oldNodes))
@@ -33,17 +45,109 @@ func newNodes(allNodes, oldNodes []string) []string {
 }
 
 // SetObject sets each AutoscalingGroup object.
-func (autoscalingGroup *AutoscalingGroup) SetObject(asg *autoscaling.Group) error {
-	autoscalingGroup.Name = *asg.AutoScalingGroupName
-	autoscalingGroup.DesiredCapacity = int(*asg.DesiredCapacity)
-	nodeHostNames, err := awsTools.GetNodeHostnames(asg.Instances)
-	if err != nil {
-		return errors.Wrap(err, "Failed to get asg instance node names and set asg object")
+func (autoscalingGroup *AutoscalingGroup) SetObject(nodeGroup *model.NodeGroup) {
+	autoscalingGroup.Name = nodeGroup.Name
+	autoscalingGroup.DesiredCapacity = nodeGroup.DesiredCapacity
+	autoscalingGroup.MaxSize = nodeGroup.MaxSize
+	autoscalingGroup.Nodes = nodeGroup.NodeNames()
+	autoscalingGroup.Zones = make(map[string]string)
+	for _, instance := range nodeGroup.Instances {
+		autoscalingGroup.Zones[instance.NodeName] = instance.AvailabilityZone
+	}
+}
+
+// keepDriftedNodes limits the rotation list to the nodes whose instances
+// differ from the ones the group currently launches. The other nodes are
+// recorded as skipped.
+func (autoscalingGroup *AutoscalingGroup) keepDriftedNodes(nodeGroup *model.NodeGroup, compareImage, compareType bool, logger *logrus.Entry) {
+	var nodes []string
+	for _, instance := range nodeGroup.Instances {
+		drift := nodeGroup.Drift(instance, compareImage, compareType)
+		if drift == "" {
+			autoscalingGroup.Skipped = append(autoscalingGroup.Skipped, model.SkippedNode{
+				NodeName: instance.NodeName,
+				Reason:   "up to date with its autoscaling group",
+			})
+			continue
+		}
+		logger.Infof("Node %s %s", instance.NodeName, drift)
+		nodes = append(nodes, instance.NodeName)
+	}
+	autoscalingGroup.Nodes = nodes
+}
+
+// keepOldNodes limits the rotation list to the nodes older than maxAge,
+// oldest first. The age of a node is that of its instance or, if unknown, of
+// the node itself. The other nodes are recorded as skipped.
+func (autoscalingGroup *AutoscalingGroup) keepOldNodes(ctx context.Context, nodeGroup *model.NodeGroup, maxAge time.Duration, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) error {
+	launchTimes := make(map[string]time.Time)
+	for _, instance := range nodeGroup.Instances {
+		launchTimes[instance.NodeName] = instance.LaunchTime
+	}
+
+	now := time.Now()
+	var nodes []string
+	for _, nodeName := range autoscalingGroup.Nodes {
+		if launchTimes[nodeName].IsZero() {
+			node, err := k8sTools.GetNode(ctx, nodeName, clientset, provider, logger)
+			if k8sErrors.IsNotFound(err) {
+				logger.Warnf("Age of node %s is unknown, keeping it in the rotation list", nodeName)
+				nodes = append(nodes, nodeName)
+				continue
+			} else if err != nil {
+				return errors.Wrapf(err, "Failed to get node %s", nodeName)
+			}
+			launchTimes[nodeName] = node.CreationTimestamp.Time
+		}
+
+		age := now.Sub(launchTimes[nodeName])
+		if age <= maxAge {
+			autoscalingGroup.Skipped = append(autoscalingGroup.Skipped, model.SkippedNode{
+				NodeName: nodeName,
+				Reason:   fmt.Sprintf("%s old, not older than the max node age of %s", age.Round(time.Second), maxAge),
+			})
+			continue
+		}
+		nodes = append(nodes, nodeName)
 	}
-	autoscalingGroup.Nodes = nodeHostNames
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return launchTimes[nodes[i]].Before(launchTimes[nodes[j]])
+	})
+	autoscalingGroup.Nodes = nodes
+
 	return nil
 }
 
+// nextBatch returns the nodes to rotate together next, up to maxScaling nodes.
+// Nodes are taken from every availability zone in turn, so that a batch does
+// not empty a zone while others still have nodes to rotate. Within a zone,
+// nodes are taken in the order of the rotation list.
+func (autoscalingGroup *AutoscalingGroup) nextBatch(maxScaling int) []string {
+	var zones []string
+	nodesByZone := make(map[string][]string)
+	for _, node := range autoscalingGroup.Nodes {
+		zone := autoscalingGroup.Zones[node]
+		if _, ok := nodesByZone[zone]; !ok {
+			zones = append(zones, zone)
+		}
+		nodesByZone[zone] = append(nodesByZone[zone], node)
+	}
+
+	var batch []string
+	for len(batch) < maxScaling && len(batch) < len(autoscalingGroup.Nodes) {
+		for _, zone := range zones {
+			if len(batch) == maxScaling || len(nodesByZone[zone]) == 0 {
+				continue
+			}
+			batch = append(batch, nodesByZone[zone][0])
+			nodesByZone[zone] = nodesByZone[zone][1:]
+		}
+	}
+
+	return batch
+}
+
 // popNodes removes a node that completed rotation from the AutoscalingGroup object node list.
 func (autoscalingGroup *AutoscalingGroup) popNodes(popNodes []string) {
 	var updatedList []string
@@ -60,48 +164,299 @@ func (autoscalingGroup *AutoscalingGroup) popNodes(popNodes []string) {
 		}
 	}
 	autoscalingGroup.Nodes = updatedList
+	autoscalingGroup.clearBlockingPDBs(popNodes)
+
+	if autoscalingGroup.checkpoint != nil {
+		autoscalingGroup.checkpoint()
+	}
 }
 
-// DrainNodes covers all node drain actions.
-func (autoscalingGroup *AutoscalingGroup) DrainNodes(nodesToDrain []string, attempts, gracePeriod, wait, waitBetweenPodEvictions int, clientset *kubernetes.Clientset, logger *logrus.Entry, nodeType string) error {
-	ctx := context.TODO()
+// pendingNodes returns the nodes of the batch that are still in the rotation list.
+func (autoscalingGroup *AutoscalingGroup) pendingNodes(batch []string) []string {
+	var nodes []string
+	for _, node := range batch {
+		for _, pending := range autoscalingGroup.Nodes {
+			if node == pending {
+				nodes = append(nodes, node)
+				break
+			}
+		}
+	}
+
+	return nodes
+}
+
+// skipNodes removes the nodes from the rotation list and records them as skipped.
+func (autoscalingGroup *AutoscalingGroup) skipNodes(nodes []string, reason string) {
+	for _, node := range nodes {
+		autoscalingGroup.Skipped = append(autoscalingGroup.Skipped, model.SkippedNode{
+			NodeName: node,
+			Reason:   reason,
+		})
+	}
+	autoscalingGroup.popNodes(nodes)
+}
+
+// recordInstancesBeforeBatch remembers the instances of the group before a
+// batch is taken out of service, so that a rollback only terminates the
+// replacements of the batch.
+func (autoscalingGroup *AutoscalingGroup) recordInstancesBeforeBatch(ctx context.Context, provider model.NodeGroupProvider) error {
+	nodeGroup, err := provider.GetNodeGroup(ctx, autoscalingGroup.Name)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get autoscaling group %s", autoscalingGroup.Name)
+	}
+
+	autoscalingGroup.instancesBeforeBatch = make(map[string]bool)
+	for _, instance := range nodeGroup.Instances {
+		autoscalingGroup.instancesBeforeBatch[instance.ID] = true
+	}
+
+	return nil
+}
+
+// rollbackBatch undoes the rotation of a batch of worker nodes. Replacements
+// that are not ready are terminated, and the nodes are returned to the
+// autoscaling group and uncordoned. The actions taken are recorded in RolledBack.
+func (autoscalingGroup *AutoscalingGroup) rollbackBatch(nodes []string, standby bool, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) error {
+	// The rotation may have been cancelled, and must be rolled back regardless.
+	ctx := context.Background()
 
-	drainOptions := &DrainOptions{
-		DeleteLocalData:    true,
-		IgnoreDaemonsets:   true,
-		Timeout:            600,
-		GracePeriodSeconds: gracePeriod,
+	defer func() {
+		if autoscalingGroup.checkpoint != nil {
+			autoscalingGroup.checkpoint()
+		}
+	}()
+
+	nodeGroup, err := provider.GetNodeGroup(ctx, autoscalingGroup.Name)
+	if err != nil {
+		return err
+	}
+
+	// Only instances launched since the batch was taken out of service are
+	// its replacements.
+	var broken, brokenIDs []string
+	for _, instance := range nodeGroup.Instances {
+		if autoscalingGroup.instancesBeforeBatch == nil || autoscalingGroup.instancesBeforeBatch[instance.ID] || instance.Standby {
+			continue
+		}
+		node, err := k8sTools.GetNode(ctx, instance.NodeName, clientset, provider, logger)
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return errors.Wrapf(err, "Failed to get node %s", instance.NodeName)
+		}
+		if err == nil && isNodeReady(node) {
+			continue
+		}
+		broken = append(broken, instance.NodeName)
+		brokenIDs = append(brokenIDs, instance.ID)
+	}
+
+	if len(broken) > 0 {
+		logger.Infof("Terminating %d replacement nodes that are not ready", len(broken))
+		err = provider.DetachNodes(ctx, true, brokenIDs, autoscalingGroup.Name, logger)
+		if err != nil {
+			return err
+		}
+		err = provider.TerminateNodes(ctx, brokenIDs, logger)
+		if err != nil {
+			return err
+		}
+		err = k8sTools.DeleteClusterNodes(ctx, broken, clientset, logger)
+		if err != nil {
+			return err
+		}
+		autoscalingGroup.recordRollback(broken, model.RollbackActionTerminated)
+	}
+
+	inStandby := make(map[string]bool)
+	for _, instance := range nodeGroup.Instances {
+		inStandby[instance.ID] = instance.Standby
+	}
+	var detached, detachedIDs, standbyNodes, standbyIDs []string
+	for _, node := range nodes {
+		instanceID, err := k8sTools.ResolveInstanceID(ctx, node, clientset, provider, logger)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to get instance ID for node %s", node)
+		}
+		if instanceID == "" {
+			logger.Warnf("Instance of node %s does not exist, unable to return it to the autoscaling group", node)
+			continue
+		}
+		standbyInstance, member := inStandby[instanceID]
+		if !member {
+			detached = append(detached, node)
+			detachedIDs = append(detachedIDs, instanceID)
+		} else if standbyInstance {
+			standbyNodes = append(standbyNodes, node)
+			standbyIDs = append(standbyIDs, instanceID)
+		}
+	}
+
+	if standby && len(standbyNodes) > 0 {
+		err = provider.ExitStandby(ctx, standbyIDs, autoscalingGroup.Name, logger)
+		if err != nil {
+			return err
+		}
+		autoscalingGroup.recordRollback(standbyNodes, model.RollbackActionReturnedToService)
+	}
+
+	if len(detached) > 0 {
+		err = provider.AttachNodes(ctx, detachedIDs, autoscalingGroup.Name, logger)
+		if err != nil {
+			return err
+		}
+		autoscalingGroup.recordRollback(detached, model.RollbackActionReattached)
+	}
+
+	for _, nodeName := range nodes {
+		node, err := k8sTools.GetNode(ctx, nodeName, clientset, provider, logger)
+		if k8sErrors.IsNotFound(err) {
+			logger.Warnf("Node %s not found, unable to uncordon it", nodeName)
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "Failed to get node %s", nodeName)
+		}
+		err = EnableScaleDown(ctx, clientset.CoreV1().Nodes(), node, logger)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to enable scale-down of node %s", nodeName)
+		}
+		if !node.Spec.Unschedulable {
+			continue
+		}
+
+		err = Uncordon(ctx, clientset.CoreV1().Nodes(), node, logger)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to uncordon node %s", nodeName)
+		}
+		autoscalingGroup.recordRollback([]string{nodeName}, model.RollbackActionUncordoned)
+	}
+
+	// Replacements that are still being launched are cancelled, but no
+	// running instance is scaled in: replacements that are ready are kept.
+	nodeGroup, err = provider.GetNodeGroup(ctx, autoscalingGroup.Name)
+	if err != nil {
+		return err
+	}
+	inService := 0
+	for _, instance := range nodeGroup.Instances {
+		if !instance.Standby {
+			inService++
+		}
+	}
+	if nodeGroup.DesiredCapacity > inService {
+		err = provider.SetCapacity(ctx, autoscalingGroup.Name, inService, nodeGroup.MaxSize, logger)
+		if err != nil {
+			return err
+		}
+	}
+	if inService != autoscalingGroup.DesiredCapacity {
+		logger.Infof("Autoscaling group %s now has a desired capacity of %d instead of %d", autoscalingGroup.Name, inService, autoscalingGroup.DesiredCapacity)
+		autoscalingGroup.DesiredCapacity = inService
+	}
+
+	return nil
+}
+
+// recordRollback records that the given action was taken on the nodes to roll back a batch.
+func (autoscalingGroup *AutoscalingGroup) recordRollback(nodes []string, action string) {
+	for _, node := range nodes {
+		autoscalingGroup.RolledBack = append(autoscalingGroup.RolledBack, model.RollbackAction{
+			NodeName: node,
+			Action:   action,
+		})
+	}
+}
+
+// isNodeReady returns true if the node reports the Ready condition.
+func isNodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// nodeBoundary is called between batches of nodes. It returns an error if the
+// rotation was cancelled and blocks for as long as the rotation is paused.
+func (autoscalingGroup *AutoscalingGroup) nodeBoundary(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if autoscalingGroup.hold == nil {
+		return nil
+	}
+
+	return autoscalingGroup.hold(ctx)
+}
+
+// nodeDrainOptions returns a copy of the drain options recording the
+// PodDisruptionBudgets blocking the evictions of the node, before calling the
+// OnEvictionBlocked hook of the options, if any.
+func (autoscalingGroup *AutoscalingGroup) nodeDrainOptions(drainOptions *DrainOptions, nodeName string, blockedMu *sync.Mutex) *DrainOptions {
+	nodeDrainOptions := *drainOptions
+	onEvictionBlocked := drainOptions.OnEvictionBlocked
+	nodeDrainOptions.OnEvictionBlocked = func(pod *corev1.Pod, pdbs []policyv1.PodDisruptionBudget) {
+		blockedMu.Lock()
+		autoscalingGroup.recordBlockingPDBs(nodeName, pdbs)
+		if autoscalingGroup.checkpoint != nil {
+			autoscalingGroup.checkpoint()
+		}
+		blockedMu.Unlock()
+
+		if onEvictionBlocked != nil {
+			onEvictionBlocked(pod, pdbs)
+		}
 	}
 
+	return &nodeDrainOptions
+}
+
+// DrainNodes covers all node drain actions. Cancelling the context stops the
+// drain before the next node; a node being drained is uncordoned again.
+func (autoscalingGroup *AutoscalingGroup) DrainNodes(ctx context.Context, nodesToDrain []string, attempts int, drainOptions *DrainOptions, wait, waitBetweenPodEvictions int, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry, nodeType string) error {
+	// Evictions blocked by PodDisruptionBudgets are reported from the
+	// goroutines evicting pods.
+	var blockedMu sync.Mutex
+
 	logger.Infof("Draining %d nodes", len(nodesToDrain))
 
 	remaining := len(nodesToDrain)
 
 	for _, nodeToDrain := range nodesToDrain {
+		if ctx.Err() != nil {
+			return errors.Wrapf(ctx.Err(), "Stopped before draining node %s", nodeToDrain)
+		}
+
 		logger.Infof("Draining node %s", nodeToDrain)
 
-		node, err := clientset.CoreV1().Nodes().Get(ctx, nodeToDrain, metav1.GetOptions{})
-		privateIP, _ := awsTools.ExtractPrivateIP(nodeToDrain)
-		instanceID, _ := awsTools.GetInstanceIDByPrivateIP(privateIP)
+		// The node and its instance may be named differently, so the node is
+		// terminated and removed by the names it is known by.
+		var instanceIDs []string
+		k8sName := nodeToDrain
+
+		node, err := k8sTools.GetNode(ctx, nodeToDrain, clientset, provider, logger)
 		if k8sErrors.IsNotFound(err) {
-			node1, err1 := clientset.CoreV1().Nodes().Get(ctx, instanceID, metav1.GetOptions{})
-			if err1 == nil {
-				err = Drain(clientset, []*corev1.Node{node1}, drainOptions, waitBetweenPodEvictions, logger)
-				logger.Infof("Draining node using AWS instance ID %s", node1.Name)
-				for i := 1; i < attempts && err != nil; i++ {
-					logger.Warnf("Failed to drain node %q on attempt %d, retrying up to %d times", node1.Name, i, attempts)
-					err = Drain(clientset, []*corev1.Node{node1}, drainOptions, waitBetweenPodEvictions, logger)
-				}
-			}
 			logger.Warnf("Node %s not found, assuming already drained", nodeToDrain)
 		} else if err != nil {
 			return errors.Wrapf(err, "Failed to get node %s", nodeToDrain)
 		} else {
-			err = Drain(clientset, []*corev1.Node{node}, drainOptions, waitBetweenPodEvictions, logger)
-			for i := 1; i < attempts && err != nil; i++ {
-				logger.Warnf("Failed to drain node %q on attempt %d, retrying up to %d times", nodesToDrain, i, attempts)
-				err = Drain(clientset, []*corev1.Node{node}, drainOptions, waitBetweenPodEvictions, logger)
+			k8sName = node.Name
+			if instanceID := k8sTools.InstanceIDFromProviderID(node.Spec.ProviderID); instanceID != "" {
+				instanceIDs = []string{instanceID}
 			}
+			nodeDrainOptions := autoscalingGroup.nodeDrainOptions(drainOptions, nodeToDrain, &blockedMu)
+			var release func()
+			release, err = autoscalingGroup.acquireDrainSlot(ctx, logger)
+			if err != nil {
+				return errors.Wrapf(err, "Stopped before draining node %s", nodeToDrain)
+			}
+			err = Drain(ctx, clientset, []*corev1.Node{node}, nodeDrainOptions, waitBetweenPodEvictions, logger)
+			for i := 1; i < attempts && err != nil && ctx.Err() == nil && isRetryableDrainError(err); i++ {
+				logger.Warnf("Failed to drain node %q on attempt %d, retrying up to %d times", nodeToDrain, i, attempts)
+				err = Drain(ctx, clientset, []*corev1.Node{node}, nodeDrainOptions, waitBetweenPodEvictions, logger)
+			}
+			release()
 			if err != nil {
 				return errors.Wrapf(err, "Failed to drain node %s", nodeToDrain)
 			}
@@ -110,12 +465,21 @@ func (autoscalingGroup *AutoscalingGroup) DrainNodes(nodesToDrain []string, atte
 
 		//Terminating nodes after each drain rotation ensures that nodes do not hang and create alerts.
 		if nodeType == "worker" {
-			err = awsTools.TerminateNodes([]string{nodeToDrain}, logger)
+			// A drained node is always cleaned up, even if the rotation is being cancelled.
+			cleanupCtx := context.Background()
+
+			if instanceIDs == nil {
+				instanceIDs, err = resolveInstanceIDs(cleanupCtx, []string{nodeToDrain}, clientset, provider, logger)
+				if err != nil {
+					return err
+				}
+			}
+			err = provider.TerminateNodes(cleanupCtx, instanceIDs, logger)
 			if err != nil {
 				return err
 			}
 
-			err = k8sTools.DeleteClusterNodes([]string{nodeToDrain}, clientset, logger)
+			err = k8sTools.DeleteClusterNodes(cleanupCtx, []string{k8sName}, clientset, logger)
 			if err != nil {
 				return err
 			}
@@ -127,7 +491,10 @@ func (autoscalingGroup *AutoscalingGroup) DrainNodes(nodesToDrain []string, atte
 		remaining--
 		if remaining > 0 {
 			logger.Infof("Waiting for %d seconds before next node drain", wait)
-			time.Sleep(time.Duration(wait) * time.Second)
+			err = sleep(ctx, time.Duration(wait)*time.Second)
+			if err != nil {
+				return errors.Wrap(err, "Stopped before next node drain")
+			}
 		}
 
 	}
@@ -135,10 +502,171 @@ func (autoscalingGroup *AutoscalingGroup) DrainNodes(nodesToDrain []string, atte
 	return nil
 }
 
+// acquireDrainSlot blocks until a node can be drained without exceeding the
+// cap on nodes drained at once across autoscaling groups, and returns the
+// function releasing the slot once the node is drained.
+func (autoscalingGroup *AutoscalingGroup) acquireDrainSlot(ctx context.Context, logger *logrus.Entry) (func(), error) {
+	slots := autoscalingGroup.drainSlots
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	default:
+	}
+
+	logger.Infof("%d nodes are already draining, waiting...", cap(slots))
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// suspendProcesses suspends the processes of the autoscaling group that are
+// not suspended yet, and returns the function resuming them once the group
+// is rotated. Processes suspended before the rotation are left suspended.
+func suspendProcesses(ctx context.Context, autoscalingGroupName string, processes []string, provider model.NodeGroupProvider, logger *logrus.Entry) (func(), error) {
+	if len(processes) == 0 {
+		return func() {}, nil
+	}
+
+	nodeGroup, err := provider.GetNodeGroup(ctx, autoscalingGroupName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get autoscaling group %s", autoscalingGroupName)
+	}
+	suspended := make(map[string]bool)
+	for _, process := range nodeGroup.SuspendedProcesses {
+		suspended[process] = true
+	}
+
+	var toSuspend []string
+	for _, process := range processes {
+		if suspended[process] {
+			logger.Infof("Process %s of autoscaling group %s is already suspended", process, autoscalingGroupName)
+			continue
+		}
+		toSuspend = append(toSuspend, process)
+	}
+	if len(toSuspend) == 0 {
+		return func() {}, nil
+	}
+
+	err = provider.SuspendProcesses(ctx, autoscalingGroupName, toSuspend, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		// The processes are resumed even if the rotation was cancelled.
+		err := provider.ResumeProcesses(context.Background(), autoscalingGroupName, toSuspend, logger)
+		if err != nil {
+			logger.WithError(err).Errorf("Failed to resume processes of autoscaling group %s", autoscalingGroupName)
+		}
+	}, nil
+}
+
+// disableScaleDown keeps cluster-autoscaler from scaling down the nodes while
+// they are rotated, if the cluster rotation asks for it.
+func disableScaleDown(ctx context.Context, cluster *model.Cluster, nodes []string, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) error {
+	if !cluster.DisableScaleDown {
+		return nil
+	}
+
+	for _, nodeName := range nodes {
+		node, err := k8sTools.GetNode(ctx, nodeName, clientset, provider, logger)
+		if k8sErrors.IsNotFound(err) {
+			logger.Warnf("Node %s not found, unable to disable its scale-down", nodeName)
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "Failed to get node %s", nodeName)
+		}
+
+		err = DisableScaleDown(ctx, clientset.CoreV1().Nodes(), node, logger)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to disable scale-down of node %s", nodeName)
+		}
+	}
+
+	return nil
+}
+
+// resolveInstanceIDs returns the IDs of the instances backing the nodes.
+// Nodes without an instance are skipped.
+func resolveInstanceIDs(ctx context.Context, nodes []string, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) ([]string, error) {
+	var instanceIDs []string
+	for _, nodeName := range nodes {
+		instanceID, err := k8sTools.ResolveInstanceID(ctx, nodeName, clientset, provider, logger)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to get instance ID for node %s", nodeName)
+		}
+		if instanceID == "" {
+			logger.Infof("Instance of node %s does not exist, skipping", nodeName)
+			continue
+		}
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+
+	return instanceIDs, nil
+}
+
+// takeOutOfService removes the instances backing the nodes from service in the
+// autoscaling group. In standby mode they are put in standby instead of being
+// detached, so that they can be returned to service if their replacement fails.
+func takeOutOfService(ctx context.Context, standby, decrement bool, nodes []string, autoscalingGroupName string, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) error {
+	instanceIDs, err := resolveInstanceIDs(ctx, nodes, clientset, provider, logger)
+	if err != nil {
+		return err
+	}
+
+	if standby {
+		return provider.EnterStandby(ctx, decrement, instanceIDs, autoscalingGroupName, logger)
+	}
+
+	return provider.DetachNodes(ctx, decrement, instanceIDs, autoscalingGroupName, logger)
+}
+
+// rollbackStandby returns the instances backing the nodes to service and
+// uncordons the nodes, undoing the removal of nodes put in standby.
+func rollbackStandby(nodes []string, autoscalingGroupName string, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) error {
+	// The rotation may have been cancelled, and must be rolled back regardless.
+	ctx := context.Background()
+
+	logger.Infof("Returning %d nodes to service in autoscaling group %s", len(nodes), autoscalingGroupName)
+	instanceIDs, err := resolveInstanceIDs(ctx, nodes, clientset, provider, logger)
+	if err != nil {
+		return err
+	}
+	err = provider.ExitStandby(ctx, instanceIDs, autoscalingGroupName, logger)
+	if err != nil {
+		return err
+	}
+
+	for _, nodeName := range nodes {
+		node, err := k8sTools.GetNode(ctx, nodeName, clientset, provider, logger)
+		if k8sErrors.IsNotFound(err) {
+			logger.Warnf("Node %s not found, unable to uncordon it", nodeName)
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "Failed to get node %s", nodeName)
+		}
+
+		err = Uncordon(ctx, clientset.CoreV1().Nodes(), node, logger)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to uncordon node %s", nodeName)
+		}
+	}
+
+	return nil
+}
+
 // getk8sClientset returns the k8s clientset. Uses local config if no client is provided.
-func getk8sClientset(cluster *model.Cluster) (*kubernetes.Clientset, error) {
-	if cluster.ClientSet != nil {
-		return cluster.ClientSet, nil
+func getk8sClientset(clientset kubernetes.Interface) (kubernetes.Interface, error) {
+	if clientset != nil {
+		return clientset, nil
 	}
 
 	clientSet, err := k8sTools.GetClientset()
@@ -149,26 +677,124 @@ func getk8sClientset(cluster *model.Cluster) (*kubernetes.Clientset, error) {
 
 }
 
+// getProvider returns the given node group provider, defaulting to AWS autoscaling groups.
+func getProvider(provider model.NodeGroupProvider) model.NodeGroupProvider {
+	if provider != nil {
+		return provider
+	}
+
+	return awsTools.NewProvider()
+}
+
 // GetSetAutoscalingGroups separates master from worker Autoscaling Groups and prepares the respective objects.
-func (metadata *RotatorMetadata) GetSetAutoscalingGroups(cluster *model.Cluster) error {
-	asgs, err := awsTools.GetAutoscalingGroups(cluster.ClusterID)
+func (metadata *RotatorMetadata) GetSetAutoscalingGroups(ctx context.Context, cluster *model.Cluster) error {
+	provider := getProvider(cluster.Provider)
+	nodeGroups, err := provider.GetNodeGroups(ctx, cluster.NodeGroupSelector())
 	if err != nil {
 		return err
 	}
-	logger.Infof("Cluster with cluster ID %s is consisted of %d Autoscaling Groups", cluster.ClusterID, len(asgs))
 
-	for _, asg := range asgs {
-		autoscalingGroup := AutoscalingGroup{}
-		err := autoscalingGroup.SetObject(asg)
+	var clientset kubernetes.Interface
+	if cluster.MaxNodeAge > 0 || len(cluster.Nodes) > 0 || cluster.LabelSelector != "" {
+		clientset, err = getk8sClientset(cluster.ClientSet)
 		if err != nil {
 			return err
 		}
+	}
+	logger.Infof("Cluster with cluster ID %s is consisted of %d Autoscaling Groups", cluster.ClusterID, len(nodeGroups))
+
+	selection, err := selectNodes(ctx, cluster, clientset, logger)
+	if err != nil {
+		return err
+	}
+
+	for _, nodeGroup := range nodeGroups {
+		if !selectsGroup(cluster, nodeGroup.Name) {
+			logger.Infof("Autoscaling group %s is not selected for rotation", nodeGroup.Name)
+			continue
+		}
+		if nodeGroup.Master && !cluster.RotateMasters || !nodeGroup.Master && !cluster.RotateWorkers {
+			continue
+		}
+
+		autoscalingGroup := AutoscalingGroup{}
+		autoscalingGroup.SetObject(nodeGroup)
+		if cluster.DriftOnly {
+			autoscalingGroup.keepDriftedNodes(nodeGroup, cluster.DriftCompareImage, cluster.DriftCompareType, logger.WithField("asg", nodeGroup.Name))
+			logger.Infof("Autoscaling group %s has %d drifted node(s), skipping %d", nodeGroup.Name, len(autoscalingGroup.Nodes), len(autoscalingGroup.Skipped))
+		}
+		if cluster.MaxNodeAge > 0 {
+			err = autoscalingGroup.keepOldNodes(ctx, nodeGroup, cluster.MaxNodeAge, clientset, provider, logger.WithField("asg", nodeGroup.Name))
+			if err != nil {
+				return err
+			}
+			logger.Infof("Autoscaling group %s has %d node(s) older than %s", nodeGroup.Name, len(autoscalingGroup.Nodes), cluster.MaxNodeAge)
+		}
+		if selection != nil {
+			autoscalingGroup.keepSelectedNodes(nodeGroup, selection)
+			logger.Infof("Autoscaling group %s has %d selected node(s)", nodeGroup.Name, len(autoscalingGroup.Nodes))
+		}
 
-		if strings.Contains(autoscalingGroup.Name, "master") && cluster.RotateMasters {
+		if nodeGroup.Master {
 			metadata.MasterGroups = append(metadata.MasterGroups, autoscalingGroup)
-		} else if !strings.Contains(autoscalingGroup.Name, "master") && cluster.RotateWorkers {
+		} else {
 			metadata.WorkerGroups = append(metadata.WorkerGroups, autoscalingGroup)
 		}
 	}
+
+	if selection != nil {
+		missing := selection.missing()
+		if len(missing) > 0 {
+			return errors.Errorf("node(s) %s not found in the autoscaling groups to rotate", strings.Join(missing, ", "))
+		}
+	}
+
 	return nil
 }
+
+// copy returns a deep copy of the autoscaling group without its rotation hooks.
+func (autoscalingGroup *AutoscalingGroup) copy() AutoscalingGroup {
+	return AutoscalingGroup{
+		Name:            autoscalingGroup.Name,
+		DesiredCapacity: autoscalingGroup.DesiredCapacity,
+		MaxSize:         autoscalingGroup.MaxSize,
+		Nodes:           append([]string(nil), autoscalingGroup.Nodes...),
+		Zones:           copyZones(autoscalingGroup.Zones),
+		Skipped:         append([]model.SkippedNode(nil), autoscalingGroup.Skipped...),
+		RolledBack:      append([]model.RollbackAction(nil), autoscalingGroup.RolledBack...),
+		Errors:          append([]string(nil), autoscalingGroup.Errors...),
+		BlockingPDBs:    append([]model.BlockingPDB(nil), autoscalingGroup.BlockingPDBs...),
+	}
+}
+
+func copyZones(zones map[string]string) map[string]string {
+	if zones == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(zones))
+	for node, zone := range zones {
+		copied[node] = zone
+	}
+
+	return copied
+}
+
+// Copy returns a deep copy of the rotator metadata without its Checkpoint function.
+func (metadata *RotatorMetadata) Copy() *RotatorMetadata {
+	copyGroups := func(groups []AutoscalingGroup) []AutoscalingGroup {
+		if groups == nil {
+			return nil
+		}
+		copied := make([]AutoscalingGroup, len(groups))
+		for i := range groups {
+			copied[i] = groups[i].copy()
+		}
+		return copied
+	}
+
+	return &RotatorMetadata{
+		MasterGroups: copyGroups(metadata.MasterGroups),
+		WorkerGroups: copyGroups(metadata.WorkerGroups),
+		CurrentGroup: metadata.CurrentGroup,
+	}
+}
@@ -0,0 +1,15 @@
+package rotator
+
+import "expvar"
+
+// Eviction metrics, published by the rotator server at /debug/vars.
+var (
+	// evictionsInFlight is the number of pods being evicted and not gone yet.
+	evictionsInFlight = expvar.NewInt("rotator_evictions_in_flight")
+	// evictionsTotal is the number of pods evicted.
+	evictionsTotal = expvar.NewInt("rotator_evictions_total")
+	// evictionRetriesTotal is the number of evictions refused with 429 Too Many Requests and retried.
+	evictionRetriesTotal = expvar.NewInt("rotator_eviction_retries_total")
+	// evictionFailuresTotal is the number of pods that failed to be evicted.
+	evictionFailuresTotal = expvar.NewInt("rotator_eviction_failures_total")
+)
@@ -0,0 +1,313 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	k8sTools "github.com/mattermost/rotator/k8s"
+	"github.com/mattermost/rotator/model"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PDBPollInterval is how often the PodDisruptionBudgets delaying a batch of
+// nodes are checked again.
+var PDBPollInterval = 10 * time.Second
+
+// pdbCoverage is a PodDisruptionBudget along with the pods it covers.
+type pdbCoverage struct {
+	pdb  policyv1.PodDisruptionBudget
+	pods []corev1.Pod
+}
+
+// name returns the namespaced name of the PodDisruptionBudget.
+func (c *pdbCoverage) name() string {
+	return fmt.Sprintf("%s/%s", c.pdb.Namespace, c.pdb.Name)
+}
+
+// nodeNames returns the names of the nodes running the covered pods, in
+// order of first appearance, given the node name of each namespaced pod.
+func (c *pdbCoverage) nodeNames(podNodes map[string]string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, pod := range c.pods {
+		nodeName := podNodes[fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)]
+		if !seen[nodeName] {
+			seen[nodeName] = true
+			names = append(names, nodeName)
+		}
+	}
+
+	return names
+}
+
+// blocks returns true if the PodDisruptionBudget does not allow all of the covered pods to be evicted.
+func (c *pdbCoverage) blocks() bool {
+	return int(c.pdb.Status.DisruptionsAllowed) < len(c.pods)
+}
+
+// getPDBCoverage returns the PodDisruptionBudgets that cover any of the given pods.
+func getPDBCoverage(ctx context.Context, client kubernetes.Interface, pods []corev1.Pod) ([]pdbCoverage, error) {
+	podsByNamespace := make(map[string][]corev1.Pod)
+	for _, pod := range pods {
+		podsByNamespace[pod.Namespace] = append(podsByNamespace[pod.Namespace], pod)
+	}
+
+	policyGroupVersion, err := servedPolicyGroupVersion(client.Discovery())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to discover the policy API")
+	}
+	if policyGroupVersion == "" {
+		return nil, nil
+	}
+
+	var coverage []pdbCoverage
+	for namespace, namespacePods := range podsByNamespace {
+		pdbs, err := listPDBs(ctx, client, policyGroupVersion, namespace)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list pod disruption budgets in namespace %s", namespace)
+		}
+
+		for _, pdb := range pdbs {
+			selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid selector of pod disruption budget %s/%s", pdb.Namespace, pdb.Name)
+			}
+
+			covered := pdbCoverage{pdb: pdb}
+			for _, pod := range namespacePods {
+				if selector.Matches(labels.Set(pod.Labels)) {
+					covered.pods = append(covered.pods, pod)
+				}
+			}
+			if len(covered.pods) > 0 {
+				coverage = append(coverage, covered)
+			}
+		}
+	}
+
+	return coverage, nil
+}
+
+// listPDBs lists the PodDisruptionBudgets of the namespace with the given
+// version of the policy API. Those listed with policy/v1beta1 are converted
+// to policy/v1.
+func listPDBs(ctx context.Context, client kubernetes.Interface, policyGroupVersion, namespace string) ([]policyv1.PodDisruptionBudget, error) {
+	if policyGroupVersion == policyv1.SchemeGroupVersion.String() {
+		pdbList, err := client.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return pdbList.Items, nil
+	}
+
+	pdbList, err := client.PolicyV1beta1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var pdbs []policyv1.PodDisruptionBudget
+	for _, pdb := range pdbList.Items {
+		pdbs = append(pdbs, pdbFromV1beta1(pdb))
+	}
+
+	return pdbs, nil
+}
+
+// pdbFromV1beta1 converts a policy/v1beta1 PodDisruptionBudget to policy/v1.
+func pdbFromV1beta1(pdb policyv1beta1.PodDisruptionBudget) policyv1.PodDisruptionBudget {
+	converted := policyv1.PodDisruptionBudget{
+		ObjectMeta: pdb.ObjectMeta,
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable:   pdb.Spec.MinAvailable,
+			Selector:       pdb.Spec.Selector,
+			MaxUnavailable: pdb.Spec.MaxUnavailable,
+		},
+		Status: policyv1.PodDisruptionBudgetStatus(pdb.Status),
+	}
+	if pdb.Spec.UnhealthyPodEvictionPolicy != nil {
+		policy := policyv1.UnhealthyPodEvictionPolicyType(*pdb.Spec.UnhealthyPodEvictionPolicy)
+		converted.Spec.UnhealthyPodEvictionPolicy = &policy
+	}
+
+	return converted
+}
+
+// getBlockingPDBs returns the PodDisruptionBudgets that do not allow all of
+// the given pods they cover to be evicted, sorted by name.
+func getBlockingPDBs(ctx context.Context, client kubernetes.Interface, pods []corev1.Pod) ([]policyv1.PodDisruptionBudget, error) {
+	coverage, err := getPDBCoverage(ctx, client, pods)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(coverage, func(i, j int) bool {
+		return coverage[i].name() < coverage[j].name()
+	})
+
+	var blocking []policyv1.PodDisruptionBudget
+	for i := range coverage {
+		if coverage[i].blocks() {
+			blocking = append(blocking, coverage[i].pdb)
+		}
+	}
+
+	return blocking, nil
+}
+
+// checkPDBs evaluates the PodDisruptionBudgets covering the pods of the nodes
+// before they are taken out of service. The pods of all the nodes count
+// against the same budgets, since the nodes are drained together. Depending on
+// the PDB policy of the cluster, the nodes are refused or delayed for as long
+// as the budgets do not allow their pods to be evicted.
+func (autoscalingGroup *AutoscalingGroup) checkPDBs(ctx context.Context, cluster *model.Cluster, nodes []string, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) error {
+	policy := cluster.GetPDBPolicy()
+	if policy == model.PDBPolicyIgnore {
+		return nil
+	}
+
+	drainOptions := clusterDrainOptions(cluster)
+	deadline := time.Now().Add(cluster.GetPDBWaitTimeout())
+	for {
+		autoscalingGroup.clearBlockingPDBs(nodes)
+		blocked, err := autoscalingGroup.batchBlockingPDBs(ctx, nodes, drainOptions, clientset, provider, logger)
+		if err != nil {
+			return err
+		}
+		if autoscalingGroup.checkpoint != nil {
+			autoscalingGroup.checkpoint()
+		}
+		if len(blocked) == 0 {
+			return nil
+		}
+
+		if policy == model.PDBPolicyRefuse {
+			return errors.Errorf("PodDisruptionBudget(s) %s do not allow the nodes to be drained", pdbNames(blocked))
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("PodDisruptionBudget(s) %s still do not allow the nodes to be drained after %s", pdbNames(blocked), cluster.GetPDBWaitTimeout())
+		}
+
+		logger.Infof("Waiting %s for PodDisruptionBudgets to allow the nodes to be drained...", PDBPollInterval)
+		err = sleep(ctx, PDBPollInterval)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// batchBlockingPDBs returns the PodDisruptionBudgets that do not allow the
+// pods a drain of all the nodes would evict to be evicted, and records them
+// against each node with a covered pod.
+func (autoscalingGroup *AutoscalingGroup) batchBlockingPDBs(ctx context.Context, nodes []string, drainOptions *DrainOptions, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) ([]policyv1.PodDisruptionBudget, error) {
+	var pods []corev1.Pod
+	podNodes := make(map[string]string)
+	for _, nodeName := range nodes {
+		nodePods, err := nodePodsForDeletion(ctx, nodeName, drainOptions, clientset, provider, logger)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range nodePods {
+			podNodes[fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)] = nodeName
+		}
+		pods = append(pods, nodePods...)
+	}
+
+	coverage, err := getPDBCoverage(ctx, clientset, pods)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(coverage, func(i, j int) bool {
+		return coverage[i].name() < coverage[j].name()
+	})
+
+	var blocked []policyv1.PodDisruptionBudget
+	for i := range coverage {
+		if !coverage[i].blocks() {
+			continue
+		}
+		pdb := coverage[i].pdb
+		blocked = append(blocked, pdb)
+		for _, nodeName := range coverage[i].nodeNames(podNodes) {
+			autoscalingGroup.recordBlockingPDBs(nodeName, []policyv1.PodDisruptionBudget{pdb})
+			logger.Warnf("PodDisruptionBudget %s/%s does not allow the pods of node %s to be evicted (%d disruption(s) allowed for %d pod(s) in the batch)", pdb.Namespace, pdb.Name, nodeName, pdb.Status.DisruptionsAllowed, len(coverage[i].pods))
+		}
+	}
+
+	return blocked, nil
+}
+
+// nodePodsForDeletion returns the pods a drain of the node would evict.
+func nodePodsForDeletion(ctx context.Context, nodeName string, drainOptions *DrainOptions, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) ([]corev1.Pod, error) {
+	node, err := k8sTools.GetNode(ctx, nodeName, clientset, provider, logger)
+	if k8sErrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get node %s", nodeName)
+	}
+
+	pods, err := getPodsForDeletion(ctx, clientset, node, drainOptions, logger)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list the pods of node %s", nodeName)
+	}
+
+	return pods, nil
+}
+
+// recordBlockingPDBs records the PodDisruptionBudgets blocking the drain of the node.
+func (autoscalingGroup *AutoscalingGroup) recordBlockingPDBs(nodeName string, pdbs []policyv1.PodDisruptionBudget) {
+	for _, pdb := range pdbs {
+		blockingPDB := model.BlockingPDB{
+			NodeName:  nodeName,
+			Namespace: pdb.Namespace,
+			Name:      pdb.Name,
+		}
+		recorded := false
+		for _, known := range autoscalingGroup.BlockingPDBs {
+			if known == blockingPDB {
+				recorded = true
+				break
+			}
+		}
+		if !recorded {
+			autoscalingGroup.BlockingPDBs = append(autoscalingGroup.BlockingPDBs, blockingPDB)
+		}
+	}
+}
+
+// clearBlockingPDBs forgets the PodDisruptionBudgets recorded as blocking the drain of the nodes.
+func (autoscalingGroup *AutoscalingGroup) clearBlockingPDBs(nodes []string) {
+	if len(autoscalingGroup.BlockingPDBs) == 0 {
+		return
+	}
+
+	cleared := make(map[string]bool)
+	for _, node := range nodes {
+		cleared[node] = true
+	}
+	var blocking []model.BlockingPDB
+	for _, blockingPDB := range autoscalingGroup.BlockingPDBs {
+		if !cleared[blockingPDB.NodeName] {
+			blocking = append(blocking, blockingPDB)
+		}
+	}
+	autoscalingGroup.BlockingPDBs = blocking
+}
+
+// pdbNames returns the comma-separated namespaced names of the PodDisruptionBudgets.
+func pdbNames(pdbs []policyv1.PodDisruptionBudget) string {
+	var names []string
+	for _, pdb := range pdbs {
+		names = append(names, fmt.Sprintf("%s/%s", pdb.Namespace, pdb.Name))
+	}
+
+	return strings.Join(names, ", ")
+}
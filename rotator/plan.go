@@ -0,0 +1,116 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+
+	k8sTools "github.com/mattermost/rotator/k8s"
+	"github.com/mattermost/rotator/model"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PlanRotateCluster returns the ordered batches of nodes a rotation of the
+// cluster would go through, along with the pods each node drain would evict
+// and the PodDisruptionBudgets that would block it. No node is detached,
+// cordoned, drained or terminated.
+func PlanRotateCluster(ctx context.Context, cluster *model.Cluster, logger *logrus.Entry) (*model.RotationPlan, error) {
+	clientset, err := getk8sClientset(cluster.ClientSet)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := getProvider(cluster.Provider)
+
+	rotatorMetadata := &RotatorMetadata{}
+	err = rotatorMetadata.GetSetAutoscalingGroups(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &model.RotationPlan{ClusterID: cluster.ClusterID}
+	drainOptions := clusterDrainOptions(cluster)
+
+	for _, masterASG := range rotatorMetadata.MasterGroups {
+		plan.Skipped = append(plan.Skipped, masterASG.Skipped...)
+		batches, err := planGroup(ctx, masterASG, 1, "master", drainOptions, clientset, provider, logger)
+		if err != nil {
+			return nil, err
+		}
+		plan.Batches = append(plan.Batches, batches...)
+	}
+
+	for _, workerASG := range rotatorMetadata.WorkerGroups {
+		plan.Skipped = append(plan.Skipped, workerASG.Skipped...)
+		batches, err := planGroup(ctx, workerASG, cluster.MaxScaling, "worker", drainOptions, clientset, provider, logger)
+		if err != nil {
+			return nil, err
+		}
+		plan.Batches = append(plan.Batches, batches...)
+	}
+
+	return plan, nil
+}
+
+// planGroup returns the batches an autoscaling group would be rotated in.
+func planGroup(ctx context.Context, autoscalingGroup AutoscalingGroup, maxScaling int, role string, drainOptions *DrainOptions, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) ([]model.RotationBatch, error) {
+	var batches []model.RotationBatch
+
+	for len(autoscalingGroup.Nodes) > 0 {
+		nodesToRotate := autoscalingGroup.nextBatch(maxScaling)
+
+		batch := model.RotationBatch{
+			AutoscalingGroup: autoscalingGroup.Name,
+			Role:             role,
+		}
+		for _, nodeName := range nodesToRotate {
+			nodePlan, err := planNodeDrain(ctx, nodeName, drainOptions, clientset, provider, logger)
+			if err != nil {
+				return nil, err
+			}
+			batch.Nodes = append(batch.Nodes, *nodePlan)
+		}
+		batches = append(batches, batch)
+
+		autoscalingGroup.popNodes(nodesToRotate)
+	}
+
+	return batches, nil
+}
+
+// planNodeDrain lists the pods that a drain of the node would evict and the
+// PodDisruptionBudgets that would block their eviction.
+func planNodeDrain(ctx context.Context, nodeName string, drainOptions *DrainOptions, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) (*model.NodePlan, error) {
+	nodePlan := &model.NodePlan{NodeName: nodeName}
+
+	node, err := k8sTools.GetNode(ctx, nodeName, clientset, provider, logger)
+	if k8sErrors.IsNotFound(err) {
+		nodePlan.Error = "node not found in the cluster"
+		return nodePlan, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get node %s", nodeName)
+	}
+
+	pods, err := getPodsForDeletion(ctx, clientset, node, drainOptions, logger)
+	if err != nil {
+		nodePlan.Error = err.Error()
+		return nodePlan, nil
+	}
+
+	for _, pod := range pods {
+		nodePlan.PodsToEvict = append(nodePlan.PodsToEvict, fmt.Sprintf("%s/%s", pod.Namespace, pod.Name))
+	}
+
+	pdbs, err := getBlockingPDBs(ctx, clientset, pods)
+	if err != nil {
+		logger.WithError(err).Warnf("Failed to get the PodDisruptionBudgets of the pods of node %s", nodeName)
+		nodePlan.Warnings = append(nodePlan.Warnings, fmt.Sprintf("PodDisruptionBudgets could not be checked: %s", err))
+	}
+	for _, pdb := range pdbs {
+		nodePlan.BlockingPDBs = append(nodePlan.BlockingPDBs, fmt.Sprintf("%s/%s", pdb.Namespace, pdb.Name))
+	}
+
+	return nodePlan, nil
+}
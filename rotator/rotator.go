@@ -1,9 +1,11 @@
 package rotator
 
 import (
+	"context"
+	"strings"
+	"sync"
 	"time"
 
-	awsTools "github.com/mattermost/rotator/aws"
 	k8sTools "github.com/mattermost/rotator/k8s"
 	"github.com/mattermost/rotator/model"
 	"github.com/pkg/errors"
@@ -11,22 +13,76 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
+// BalanceWait is the time given to an autoscaling group to start replacing
+// detached or terminated instances.
+var BalanceWait = 60 * time.Second
+
 // AutoscalingGroup creates a autoscaling group object.
 type AutoscalingGroup struct {
 	Name            string
 	DesiredCapacity int
+	MaxSize         int `json:",omitempty"`
 	Nodes           []string
+	Zones           map[string]string      `json:",omitempty"`
+	Skipped         []model.SkippedNode    `json:",omitempty"`
+	RolledBack      []model.RollbackAction `json:",omitempty"`
+	Errors          []string               `json:",omitempty"`
+	BlockingPDBs    []model.BlockingPDB    `json:",omitempty"`
+
+	// checkpoint is called every time nodes are removed from the rotation list.
+	checkpoint func()
+	// hold is called before every batch of nodes is rotated.
+	hold func(ctx context.Context) error
+	// drainSlots, if set, caps the number of nodes drained at once across
+	// the autoscaling groups rotating in parallel.
+	drainSlots chan struct{}
+	// instancesBeforeBatch are the IDs of the instances of the group before
+	// the current batch was taken out of service.
+	instancesBeforeBatch map[string]bool
 }
 
 // RotatorMetadata is a container struct for any metadata related to cluster rotator.
 type RotatorMetadata struct {
 	MasterGroups []AutoscalingGroup `json:"MasterGroups,omitempty"`
 	WorkerGroups []AutoscalingGroup `json:"WorkerGroups,omitempty"`
+	CurrentGroup string             `json:"CurrentGroup,omitempty"`
+
+	// Checkpoint, if set, is called from the rotation goroutine every time the rotation makes progress.
+	Checkpoint func(metadata *RotatorMetadata) `json:"-"`
+	// Hold, if set, is called before every batch of nodes is rotated and blocks for as long as the rotation is paused.
+	Hold func(ctx context.Context) error `json:"-"`
+
+	// mu guards the groups and current group while worker groups rotate in parallel.
+	mu sync.Mutex
+	// running are the names of the worker groups being rotated.
+	running []string
+}
+
+// checkpoint reports the current state of the rotation to the Checkpoint function, if any.
+func (metadata *RotatorMetadata) checkpoint() {
+	metadata.mu.Lock()
+	defer metadata.mu.Unlock()
+
+	metadata.report()
+}
+
+// report calls the Checkpoint function, if any. Must be called with the lock held.
+func (metadata *RotatorMetadata) report() {
+	if metadata.Checkpoint != nil {
+		metadata.Checkpoint(metadata)
+	}
 }
 
 // InitRotateCluster is used to call the RotateCluster function.
 func InitRotateCluster(cluster *model.Cluster, rotatorMetadata *RotatorMetadata, logger *logrus.Entry) (*RotatorMetadata, error) {
-	rotatorMetadata, err := RotateCluster(cluster, logger, rotatorMetadata)
+	return InitRotateClusterWithContext(context.Background(), cluster, rotatorMetadata, logger)
+}
+
+// InitRotateClusterWithContext is used to call the RotateCluster function. Once the
+// context is cancelled the rotation stops at the next safe point and the returned
+// metadata can be used to resume it.
+func InitRotateClusterWithContext(ctx context.Context, cluster *model.Cluster, rotatorMetadata *RotatorMetadata, logger *logrus.Entry) (*RotatorMetadata, error) {
+	rotatorMetadata, err := RotateCluster(ctx, cluster, logger, rotatorMetadata)
 	if err != nil {
 		logger.WithError(err).Error("failed to rotate cluster")
 		return rotatorMetadata, err
@@ -36,76 +92,223 @@ func InitRotateCluster(cluster *model.Cluster, rotatorMetadata *RotatorMetadata,
 }
 
 // RotateCluster is used to rotate the Cluster nodes.
-func RotateCluster(cluster *model.Cluster, logger *logrus.Entry, rotatorMetadata *RotatorMetadata) (*RotatorMetadata, error) {
-	clientset, err := getk8sClientset(cluster)
+func RotateCluster(ctx context.Context, cluster *model.Cluster, logger *logrus.Entry, rotatorMetadata *RotatorMetadata) (*RotatorMetadata, error) {
+	clientset, err := getk8sClientset(cluster.ClientSet)
 	if err != nil {
 		return rotatorMetadata, err
 	}
 
+	provider := getProvider(cluster.Provider)
+
 	if rotatorMetadata.MasterGroups == nil && rotatorMetadata.WorkerGroups == nil {
-		err = rotatorMetadata.GetSetAutoscalingGroups(cluster)
+		err = rotatorMetadata.GetSetAutoscalingGroups(ctx, cluster)
 		if err != nil {
 			return rotatorMetadata, err
 		}
 	}
 
-	for index, masterASG := range rotatorMetadata.MasterGroups {
-		logger.Infof("The autoscaling group %s has %d instance(s)", masterASG.Name, masterASG.DesiredCapacity)
+	rotatorMetadata.checkpoint()
 
-		err = MasterNodeRotation(cluster, &masterASG, clientset, logger)
+	for index := range rotatorMetadata.MasterGroups {
+		err = rotatorMetadata.rotateMasterGroup(ctx, cluster, index, clientset, provider, logger)
 		if err != nil {
-			rotatorMetadata.MasterGroups[index] = masterASG
 			return rotatorMetadata, err
 		}
+	}
 
-		rotatorMetadata.MasterGroups[index] = masterASG
+	err = rotatorMetadata.rotateWorkerGroups(ctx, cluster, clientset, provider, logger)
+	if err != nil {
+		return rotatorMetadata, err
+	}
 
-		logger.Infof("Checking that all %d nodes are running...", masterASG.DesiredCapacity)
-		err = FinalCheck(&masterASG, clientset, logger)
-		if err != nil {
-			return rotatorMetadata, err
-		}
+	rotatorMetadata.CurrentGroup = ""
+	rotatorMetadata.checkpoint()
 
-		logger.Infof("ASG %s rotated successfully.", masterASG.Name)
+	logger.Info("All ASGs rotated successfully")
+	return rotatorMetadata, nil
+}
+
+// rotateMasterGroup rotates the master group at the given index.
+func (metadata *RotatorMetadata) rotateMasterGroup(ctx context.Context, cluster *model.Cluster, index int, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) error {
+	masterASG := &metadata.MasterGroups[index]
+	masterASG.checkpoint = metadata.checkpoint
+	masterASG.hold = metadata.Hold
+	metadata.CurrentGroup = masterASG.Name
+	metadata.checkpoint()
+
+	logger.Infof("The autoscaling group %s has %d instance(s)", masterASG.Name, masterASG.DesiredCapacity)
+
+	resume, err := suspendProcesses(ctx, masterASG.Name, cluster.GetSuspendProcesses(), provider, logger)
+	if err != nil {
+		return err
 	}
+	defer resume()
 
-	for index, workerASG := range rotatorMetadata.WorkerGroups {
-		logger.Infof("The autoscaling group %s has %d instance(s)", workerASG.Name, workerASG.DesiredCapacity)
+	err = MasterNodeRotation(ctx, cluster, masterASG, clientset, provider, logger)
+	if err != nil {
+		return err
+	}
 
-		err = WorkerNodeRotation(cluster, &workerASG, clientset, logger)
-		if err != nil {
-			rotatorMetadata.WorkerGroups[index] = workerASG
-			return rotatorMetadata, err
-		}
+	logger.Infof("Checking that all %d nodes are running...", masterASG.DesiredCapacity)
+	err = FinalCheck(ctx, masterASG, clientset, provider, logger)
+	if err != nil {
+		return err
+	}
 
-		rotatorMetadata.WorkerGroups[index] = workerASG
+	logger.Infof("ASG %s rotated successfully.", masterASG.Name)
 
-		logger.Infof("Checking that all %d nodes are running...", workerASG.DesiredCapacity)
-		err = FinalCheck(&workerASG, clientset, logger)
-		if err != nil {
-			return rotatorMetadata, err
+	return nil
+}
+
+// rotateWorkerGroups rotates up to cluster.ParallelGroups worker groups at a
+// time. Once a group fails no other group is started, and the errors of the
+// groups already rotating are collected once they are done.
+func (metadata *RotatorMetadata) rotateWorkerGroups(ctx context.Context, cluster *model.Cluster, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) error {
+	parallelGroups := cluster.ParallelGroups
+	if parallelGroups < 1 {
+		parallelGroups = 1
+	}
+	var drainSlots chan struct{}
+	if cluster.MaxDrainingNodes > 0 {
+		drainSlots = make(chan struct{}, cluster.MaxDrainingNodes)
+	}
+
+	groupSlots := make(chan struct{}, parallelGroups)
+	var wg sync.WaitGroup
+	var errorsMu sync.Mutex
+	var groupErrors []error
+	var failedGroups []string
+
+	for index := range metadata.WorkerGroups {
+		select {
+		case groupSlots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		errorsMu.Lock()
+		failed := len(groupErrors) > 0
+		errorsMu.Unlock()
+		if failed || ctx.Err() != nil {
+			break
 		}
 
-		logger.Infof("ASG %s rotated successfully.", workerASG.Name)
+		wg.Add(1)
+		go func(index int, name string) {
+			defer wg.Done()
+			defer func() { <-groupSlots }()
+
+			err := metadata.rotateWorkerGroup(ctx, cluster, index, drainSlots, clientset, provider, logger)
+			if err != nil {
+				errorsMu.Lock()
+				groupErrors = append(groupErrors, err)
+				failedGroups = append(failedGroups, name)
+				errorsMu.Unlock()
+			}
+		}(index, metadata.WorkerGroups[index].Name)
 	}
+	wg.Wait()
 
-	logger.Info("All ASGs rotated successfully")
-	return rotatorMetadata, nil
+	switch len(groupErrors) {
+	case 0:
+		return ctx.Err()
+	case 1:
+		return groupErrors[0]
+	}
+
+	var messages []string
+	for i, err := range groupErrors {
+		messages = append(messages, failedGroups[i]+": "+err.Error())
+	}
+
+	return errors.Errorf("%d autoscaling groups failed to rotate: %s", len(groupErrors), strings.Join(messages, "; "))
 }
 
-// FinalCheck checks that rotation is complete.
-func FinalCheck(autoscalingGroup *AutoscalingGroup, clientset *kubernetes.Clientset, logger *logrus.Entry) error {
-	asg, err := awsTools.AutoScalingGroupReady(autoscalingGroup.Name, autoscalingGroup.DesiredCapacity, logger)
+// rotateWorkerGroup rotates the worker group at the given index. The group is
+// rotated on a copy, which is written back to the metadata at every
+// checkpoint, so that other groups can rotate at the same time.
+func (metadata *RotatorMetadata) rotateWorkerGroup(ctx context.Context, cluster *model.Cluster, index int, drainSlots chan struct{}, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) (err error) {
+	metadata.mu.Lock()
+	group := metadata.WorkerGroups[index].copy()
+	metadata.mu.Unlock()
+
+	workerASG := &group
+	workerASG.checkpoint = func() {
+		metadata.mu.Lock()
+		defer metadata.mu.Unlock()
+
+		metadata.WorkerGroups[index] = workerASG.copy()
+		metadata.report()
+	}
+	workerASG.hold = metadata.Hold
+	workerASG.drainSlots = drainSlots
+	if cluster.ParallelGroups > 1 {
+		logger = logger.WithField("asg", workerASG.Name)
+	}
+
+	metadata.setRunning(workerASG.Name, true)
+	defer func() {
+		if err != nil && ctx.Err() == nil {
+			workerASG.Errors = append(workerASG.Errors, err.Error())
+		}
+		metadata.setRunning(workerASG.Name, false)
+		workerASG.checkpoint()
+	}()
+
+	logger.Infof("The autoscaling group %s has %d instance(s)", workerASG.Name, workerASG.DesiredCapacity)
+
+	resume, err := suspendProcesses(ctx, workerASG.Name, cluster.GetSuspendProcesses(), provider, logger)
 	if err != nil {
-		return errors.Wrap(err, "Failed to get AutoscalingGroup ready")
+		return err
 	}
+	defer resume()
 
-	asgNodes, err := awsTools.GetNodeHostnames(asg.Instances)
+	if cluster.Strategy == model.RotationStrategySurge {
+		err = WorkerNodeSurgeRotation(ctx, cluster, workerASG, clientset, provider, logger)
+	} else {
+		err = WorkerNodeRotation(ctx, cluster, workerASG, clientset, provider, logger)
+	}
 	if err != nil {
-		return errors.Wrap(err, "Failed to get node hostnames")
+		return err
 	}
 
-	err = k8sTools.NodesReady(asgNodes, clientset, logger)
+	logger.Infof("Checking that all %d nodes are running...", workerASG.DesiredCapacity)
+	err = FinalCheck(ctx, workerASG, clientset, provider, logger)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("ASG %s rotated successfully.", workerASG.Name)
+
+	return nil
+}
+
+// setRunning records whether the worker group is being rotated, keeping the
+// current group of the metadata up to date.
+func (metadata *RotatorMetadata) setRunning(name string, running bool) {
+	metadata.mu.Lock()
+	defer metadata.mu.Unlock()
+
+	var names []string
+	for _, runningName := range metadata.running {
+		if runningName != name {
+			names = append(names, runningName)
+		}
+	}
+	if running {
+		names = append(names, name)
+	}
+	metadata.running = names
+	metadata.CurrentGroup = strings.Join(names, ",")
+	metadata.report()
+}
+
+// FinalCheck checks that rotation is complete.
+func FinalCheck(ctx context.Context, autoscalingGroup *AutoscalingGroup, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) error {
+	nodeGroup, err := provider.WaitForCapacity(ctx, autoscalingGroup.Name, autoscalingGroup.DesiredCapacity, logger)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get AutoscalingGroup ready")
+	}
+
+	err = k8sTools.NodesReady(ctx, nodeGroup.NodeNames(), clientset, provider, logger)
 	if err != nil {
 		return errors.Wrap(err, "Failed to get cluster nodes ready")
 	}
@@ -114,44 +317,58 @@ func FinalCheck(autoscalingGroup *AutoscalingGroup, clientset *kubernetes.Client
 }
 
 // MasterNodeRotation handles rotation of master nodes.
-func MasterNodeRotation(cluster *model.Cluster, autoscalingGroup *AutoscalingGroup, clientset *kubernetes.Clientset, logger *logrus.Entry) error {
+func MasterNodeRotation(ctx context.Context, cluster *model.Cluster, autoscalingGroup *AutoscalingGroup, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) error {
 
 	for len(autoscalingGroup.Nodes) > 0 {
+		err := autoscalingGroup.nodeBoundary(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "Stopped rotation of autoscaling group %s", autoscalingGroup.Name)
+		}
+
 		logger.Infof("The number of nodes in the ASG to be rotated is %d", len(autoscalingGroup.Nodes))
 
 		nodesToRotate := []string{autoscalingGroup.Nodes[0]}
 
-		err := autoscalingGroup.DrainNodes(nodesToRotate, 10, cluster.EvictGracePeriod, cluster.WaitBetweenDrains, cluster.WaitBetweenPodEvictions, clientset, logger, "master")
+		err = autoscalingGroup.checkPDBs(ctx, cluster, nodesToRotate, clientset, provider, logger)
 		if err != nil {
 			return err
 		}
 
-		err = awsTools.DetachNodes(false, nodesToRotate, autoscalingGroup.Name, logger)
+		err = autoscalingGroup.DrainNodes(ctx, nodesToRotate, 10, clusterDrainOptions(cluster), cluster.WaitBetweenDrains, cluster.WaitBetweenPodEvictions, clientset, provider, logger, "master")
 		if err != nil {
 			return err
 		}
 
-		err = awsTools.TerminateNodes(nodesToRotate, logger)
+		// Once a node is detached it must not be left behind until its replacement
+		// is ready, so the rest of the batch ignores cancellation.
+		replaceCtx := context.Background()
+
+		instanceIDs, err := resolveInstanceIDs(replaceCtx, nodesToRotate, clientset, provider, logger)
 		if err != nil {
 			return err
 		}
 
-		logger.Info("Sleeping 60 seconds for autoscaling group to balance...")
-		time.Sleep(60 * time.Second)
+		err = provider.DetachNodes(replaceCtx, false, instanceIDs, autoscalingGroup.Name, logger)
+		if err != nil {
+			return err
+		}
 
-		autoscalingGroupReady, err := awsTools.AutoScalingGroupReady(autoscalingGroup.Name, autoscalingGroup.DesiredCapacity, logger)
+		err = provider.TerminateNodes(replaceCtx, instanceIDs, logger)
 		if err != nil {
 			return err
 		}
 
-		nodeHostnames, err := awsTools.GetNodeHostnames(autoscalingGroupReady.Instances)
+		logger.Infof("Sleeping %s for autoscaling group to balance...", BalanceWait)
+		time.Sleep(BalanceWait)
+
+		nodeGroup, err := provider.WaitForCapacity(replaceCtx, autoscalingGroup.Name, autoscalingGroup.DesiredCapacity, logger)
 		if err != nil {
 			return err
 		}
 
-		newNodes := newNodes(nodeHostnames, autoscalingGroup.Nodes)
+		newNodes := newNodes(nodeGroup.NodeNames(), autoscalingGroup.Nodes)
 
-		err = k8sTools.NodesReady(newNodes, clientset, logger)
+		err = k8sTools.NodesReady(replaceCtx, newNodes, clientset, provider, logger)
 		if err != nil {
 			return err
 		}
@@ -164,54 +381,262 @@ func MasterNodeRotation(cluster *model.Cluster, autoscalingGroup *AutoscalingGro
 }
 
 // WorkerNodeRotation handles rotation of worker nodes.
-func WorkerNodeRotation(cluster *model.Cluster, autoscalingGroup *AutoscalingGroup, clientset *kubernetes.Clientset, logger *logrus.Entry) error {
+func WorkerNodeRotation(ctx context.Context, cluster *model.Cluster, autoscalingGroup *AutoscalingGroup, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) error {
 
 	for len(autoscalingGroup.Nodes) > 0 {
+		err := autoscalingGroup.nodeBoundary(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "Stopped rotation of autoscaling group %s", autoscalingGroup.Name)
+		}
+
 		logger.Infof("The number of nodes in the ASG to be rotated is %d", len(autoscalingGroup.Nodes))
 
-		var nodesToRotate []string
+		nodesToRotate := autoscalingGroup.nextBatch(cluster.MaxScaling)
 
-		if len(autoscalingGroup.Nodes) < cluster.MaxScaling {
-			nodesToRotate = autoscalingGroup.Nodes
-		} else {
-			nodesToRotate = autoscalingGroup.Nodes[:cluster.MaxScaling]
+		err = autoscalingGroup.checkPDBs(ctx, cluster, nodesToRotate, clientset, provider, logger)
+		if err != nil {
+			if ctx.Err() != nil {
+				return errors.Wrapf(err, "Stopped rotation of autoscaling group %s", autoscalingGroup.Name)
+			}
+			err = autoscalingGroup.batchRefused(err, cluster, nodesToRotate, logger)
+			if err != nil {
+				return err
+			}
+			continue
 		}
 
-		err := awsTools.DetachNodes(false, nodesToRotate, autoscalingGroup.Name, logger)
+		err = disableScaleDown(ctx, cluster, nodesToRotate, clientset, provider, logger)
 		if err != nil {
 			return err
 		}
 
-		logger.Info("Sleeping 60 seconds for autoscaling group to balance...")
-		time.Sleep(60 * time.Second)
+		err = autoscalingGroup.recordInstancesBeforeBatch(ctx, provider)
+		if err != nil {
+			return err
+		}
 
-		autoscalingGroupReady, err := awsTools.AutoScalingGroupReady(autoscalingGroup.Name, autoscalingGroup.DesiredCapacity, logger)
+		// Once nodes are detached they must not be left behind until their
+		// replacements are ready, so this part of the batch ignores cancellation.
+		replaceCtx := context.Background()
+
+		err = takeOutOfService(replaceCtx, cluster.Standby, false, nodesToRotate, autoscalingGroup.Name, clientset, provider, logger)
 		if err != nil {
 			return err
 		}
 
-		nodeHostnames, err := awsTools.GetNodeHostnames(autoscalingGroupReady.Instances)
+		logger.Infof("Sleeping %s for autoscaling group to balance...", BalanceWait)
+		time.Sleep(BalanceWait)
+
+		nodeGroup, err := provider.WaitForCapacity(replaceCtx, autoscalingGroup.Name, autoscalingGroup.DesiredCapacity, logger)
+		if err != nil {
+			err = autoscalingGroup.batchFailed(ctx, err, cluster, nodesToRotate, clientset, provider, logger)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		newNodes := newNodes(nodeGroup.NodeNames(), autoscalingGroup.Nodes)
+
+		err = k8sTools.NodesReady(replaceCtx, newNodes, clientset, provider, logger)
+		if err != nil {
+			err = autoscalingGroup.batchFailed(ctx, err, cluster, nodesToRotate, clientset, provider, logger)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = autoscalingGroup.DrainNodes(ctx, nodesToRotate, 10, clusterDrainOptions(cluster), cluster.WaitBetweenDrains, cluster.WaitBetweenPodEvictions, clientset, provider, logger, "worker")
+		if err != nil {
+			err = autoscalingGroup.batchFailed(ctx, err, cluster, nodesToRotate, clientset, provider, logger)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(autoscalingGroup.Nodes) > 0 {
+			logger.Infof("Waiting for %d seconds before next node rotation", cluster.WaitBetweenRotations)
+			err = sleep(ctx, time.Duration(cluster.WaitBetweenRotations)*time.Second)
+			if err != nil {
+				return errors.Wrapf(err, "Stopped rotation of autoscaling group %s", autoscalingGroup.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// WorkerNodeSurgeRotation handles rotation of worker nodes by scaling the
+// autoscaling group up before every batch, so that the cluster never runs
+// below its original capacity. The original size of the group is restored
+// once the rotation ends, including on failure or cancellation.
+func WorkerNodeSurgeRotation(ctx context.Context, cluster *model.Cluster, autoscalingGroup *AutoscalingGroup, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) (err error) {
+	if len(autoscalingGroup.Nodes) == 0 {
+		return nil
+	}
+
+	maxSize := autoscalingGroup.MaxSize
+	if maxSize == 0 {
+		// Rotations persisted before the max size was recorded.
+		nodeGroup, err := provider.GetNodeGroup(ctx, autoscalingGroup.Name)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to get autoscaling group %s", autoscalingGroup.Name)
+		}
+		maxSize = nodeGroup.MaxSize
+	}
+
+	defer func() {
+		// A rollback may have kept ready replacements, growing the group.
+		if maxSize < autoscalingGroup.DesiredCapacity {
+			maxSize = autoscalingGroup.DesiredCapacity
+		}
+		restoreErr := provider.SetCapacity(context.Background(), autoscalingGroup.Name, autoscalingGroup.DesiredCapacity, maxSize, logger)
+		if restoreErr != nil {
+			logger.WithError(restoreErr).Errorf("Failed to restore the size of autoscaling group %s", autoscalingGroup.Name)
+			if err == nil {
+				err = restoreErr
+			}
+		}
+	}()
+
+	for len(autoscalingGroup.Nodes) > 0 {
+		err = autoscalingGroup.nodeBoundary(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "Stopped rotation of autoscaling group %s", autoscalingGroup.Name)
+		}
+
+		logger.Infof("The number of nodes in the ASG to be rotated is %d", len(autoscalingGroup.Nodes))
+
+		nodesToRotate := autoscalingGroup.nextBatch(cluster.MaxScaling)
+
+		err = autoscalingGroup.checkPDBs(ctx, cluster, nodesToRotate, clientset, provider, logger)
+		if err != nil {
+			if ctx.Err() != nil {
+				return errors.Wrapf(err, "Stopped rotation of autoscaling group %s", autoscalingGroup.Name)
+			}
+			err = autoscalingGroup.batchRefused(err, cluster, nodesToRotate, logger)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = disableScaleDown(ctx, cluster, nodesToRotate, clientset, provider, logger)
+		if err != nil {
+			return err
+		}
+
+		err = autoscalingGroup.recordInstancesBeforeBatch(ctx, provider)
 		if err != nil {
 			return err
 		}
 
-		newNodes := newNodes(nodeHostnames, autoscalingGroup.Nodes)
+		surgeCapacity := autoscalingGroup.DesiredCapacity + len(nodesToRotate)
+		surgeMaxSize := maxSize
+		if surgeMaxSize < surgeCapacity {
+			surgeMaxSize = surgeCapacity
+		}
+
+		// Once the group is scaled up the old nodes must be replaced before
+		// stopping, so this part of the batch ignores cancellation.
+		replaceCtx := context.Background()
 
-		err = k8sTools.NodesReady(newNodes, clientset, logger)
+		err = provider.SetCapacity(replaceCtx, autoscalingGroup.Name, surgeCapacity, surgeMaxSize, logger)
 		if err != nil {
 			return err
 		}
 
-		err = autoscalingGroup.DrainNodes(nodesToRotate, 10, cluster.EvictGracePeriod, cluster.WaitBetweenDrains, cluster.WaitBetweenPodEvictions, clientset, logger, "worker")
+		nodeGroup, err := provider.WaitForCapacity(replaceCtx, autoscalingGroup.Name, surgeCapacity, logger)
+		if err != nil {
+			err = autoscalingGroup.batchFailed(ctx, err, cluster, nodesToRotate, clientset, provider, logger)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		newNodes := newNodes(nodeGroup.NodeNames(), autoscalingGroup.Nodes)
+
+		err = k8sTools.NodesReady(replaceCtx, newNodes, clientset, provider, logger)
+		if err != nil {
+			err = autoscalingGroup.batchFailed(ctx, err, cluster, nodesToRotate, clientset, provider, logger)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Removing the old nodes with decrement brings the group back to its original
+		// capacity without launching replacements for the old nodes.
+		err = takeOutOfService(replaceCtx, cluster.Standby, true, nodesToRotate, autoscalingGroup.Name, clientset, provider, logger)
 		if err != nil {
 			return err
 		}
 
+		err = autoscalingGroup.DrainNodes(ctx, nodesToRotate, 10, clusterDrainOptions(cluster), cluster.WaitBetweenDrains, cluster.WaitBetweenPodEvictions, clientset, provider, logger, "worker")
+		if err != nil {
+			err = autoscalingGroup.batchFailed(ctx, err, cluster, nodesToRotate, clientset, provider, logger)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
 		if len(autoscalingGroup.Nodes) > 0 {
 			logger.Infof("Waiting for %d seconds before next node rotation", cluster.WaitBetweenRotations)
-			time.Sleep(time.Duration(cluster.WaitBetweenRotations) * time.Second)
+			err = sleep(ctx, time.Duration(cluster.WaitBetweenRotations)*time.Second)
+			if err != nil {
+				return errors.Wrapf(err, "Stopped rotation of autoscaling group %s", autoscalingGroup.Name)
+			}
 		}
 	}
 
 	return nil
 }
+
+// batchFailed applies the failure policy of the cluster to a batch of worker
+// nodes that failed to rotate. It returns nil if the rotation goes on with
+// the next batch.
+func (autoscalingGroup *AutoscalingGroup) batchFailed(ctx context.Context, err error, cluster *model.Cluster, batch []string, clientset kubernetes.Interface, provider model.NodeGroupProvider, logger *logrus.Entry) error {
+	policy := cluster.GetFailurePolicy()
+	if policy == model.FailurePolicyAbort {
+		return err
+	}
+
+	// Nodes of the batch that were already terminated are not rolled back.
+	nodes := autoscalingGroup.pendingNodes(batch)
+
+	logger.WithError(err).Warnf("Rotation of %d nodes failed, rolling back", len(nodes))
+	rollbackErr := autoscalingGroup.rollbackBatch(nodes, cluster.Standby, clientset, provider, logger)
+	if rollbackErr != nil {
+		return errors.Wrapf(err, "failed to roll back nodes (%s)", rollbackErr)
+	}
+
+	if policy == model.FailurePolicyRollback || ctx.Err() != nil {
+		return errors.Wrap(err, "rolled back nodes")
+	}
+
+	logger.Warnf("Skipping %d rolled back nodes and continuing the rotation", len(nodes))
+	autoscalingGroup.Errors = append(autoscalingGroup.Errors, err.Error())
+	autoscalingGroup.skipNodes(nodes, "rolled back after failed rotation: "+err.Error())
+
+	return nil
+}
+
+// batchRefused handles a batch of worker nodes refused before any of its
+// nodes was taken out of service, so there is nothing to roll back. The
+// batch is skipped if the failure policy continues the rotation, and the
+// rotation stops otherwise.
+func (autoscalingGroup *AutoscalingGroup) batchRefused(err error, cluster *model.Cluster, batch []string, logger *logrus.Entry) error {
+	if cluster.GetFailurePolicy() != model.FailurePolicyContinue {
+		return err
+	}
+
+	logger.WithError(err).Warnf("Skipping %d refused nodes and continuing the rotation", len(batch))
+	autoscalingGroup.Errors = append(autoscalingGroup.Errors, err.Error())
+	autoscalingGroup.skipNodes(batch, "refused before rotation: "+err.Error())
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package rotator
+
+import (
+	"context"
+	"sort"
+
+	k8sTools "github.com/mattermost/rotator/k8s"
+	"github.com/mattermost/rotator/model"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// nodeSelection is the set of nodes a rotation is narrowed to, identified by
+// node name or instance ID.
+type nodeSelection struct {
+	selected map[string]bool
+	// requested maps the nodes explicitly requested to the names and instance
+	// IDs they are known by, to report those not found in any group.
+	requested map[string][]string
+	found     map[string]bool
+}
+
+// selectNodes returns the nodes of the cluster matching both the explicit
+// node list and the label selector of the cluster, or nil if the rotation is
+// not narrowed to specific nodes.
+func selectNodes(ctx context.Context, cluster *model.Cluster, clientset kubernetes.Interface, logger logrus.FieldLogger) (*nodeSelection, error) {
+	if len(cluster.Nodes) == 0 && cluster.LabelSelector == "" {
+		return nil, nil
+	}
+
+	var requested map[string][]string
+	if len(cluster.Nodes) > 0 {
+		requested = make(map[string][]string)
+		for _, nodeName := range cluster.Nodes {
+			identities := []string{nodeName}
+			node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				return nil, errors.Wrapf(err, "Failed to get node %s", nodeName)
+			}
+			if err == nil {
+				if instanceID := k8sTools.InstanceIDFromProviderID(node.Spec.ProviderID); instanceID != "" {
+					identities = append(identities, instanceID)
+				}
+			}
+			requested[nodeName] = identities
+		}
+	}
+
+	var labeled map[string]bool
+	if cluster.LabelSelector != "" {
+		nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: cluster.LabelSelector})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to list nodes matching %q", cluster.LabelSelector)
+		}
+		logger.Infof("%d node(s) match the label selector %q", len(nodes.Items), cluster.LabelSelector)
+
+		labeled = make(map[string]bool)
+		for _, node := range nodes.Items {
+			labeled[node.Name] = true
+			if instanceID := k8sTools.InstanceIDFromProviderID(node.Spec.ProviderID); instanceID != "" {
+				labeled[instanceID] = true
+			}
+		}
+	}
+
+	selection := &nodeSelection{
+		selected:  make(map[string]bool),
+		requested: requested,
+		found:     make(map[string]bool),
+	}
+	if requested == nil {
+		selection.selected = labeled
+		return selection, nil
+	}
+	for _, identities := range requested {
+		for _, identity := range identities {
+			if labeled == nil || labeled[identity] {
+				selection.selected[identity] = true
+			}
+		}
+	}
+
+	return selection, nil
+}
+
+// includes returns true if the instance is selected for rotation.
+func (selection *nodeSelection) includes(instance model.Instance) bool {
+	return selection.selected[instance.NodeName] || selection.selected[instance.ID]
+}
+
+// markFound records the explicitly requested nodes backed by instances of the group.
+func (selection *nodeSelection) markFound(nodeGroup *model.NodeGroup) {
+	for _, instance := range nodeGroup.Instances {
+		for nodeName, identities := range selection.requested {
+			for _, identity := range identities {
+				if identity == instance.NodeName || identity == instance.ID {
+					selection.found[nodeName] = true
+				}
+			}
+		}
+	}
+}
+
+// missing returns the explicitly requested nodes that are not in any of the
+// autoscaling groups the rotation went through.
+func (selection *nodeSelection) missing() []string {
+	var missing []string
+	for nodeName := range selection.requested {
+		if !selection.found[nodeName] {
+			missing = append(missing, nodeName)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing
+}
+
+// keepSelectedNodes limits the rotation list to the selected nodes. The
+// other nodes are recorded as skipped.
+func (autoscalingGroup *AutoscalingGroup) keepSelectedNodes(nodeGroup *model.NodeGroup, selection *nodeSelection) {
+	selection.markFound(nodeGroup)
+
+	instances := make(map[string]model.Instance)
+	for _, instance := range nodeGroup.Instances {
+		instances[instance.NodeName] = instance
+	}
+
+	var nodes []string
+	for _, nodeName := range autoscalingGroup.Nodes {
+		instance, ok := instances[nodeName]
+		if !ok {
+			instance = model.Instance{NodeName: nodeName}
+		}
+		if !selection.includes(instance) {
+			autoscalingGroup.Skipped = append(autoscalingGroup.Skipped, model.SkippedNode{
+				NodeName: nodeName,
+				Reason:   "not selected for rotation",
+			})
+			continue
+		}
+		nodes = append(nodes, nodeName)
+	}
+	autoscalingGroup.Nodes = nodes
+}
+
+// selectsGroup returns true if the autoscaling group is to be rotated
+// according to the include and exclude lists of the cluster.
+func selectsGroup(cluster *model.Cluster, name string) bool {
+	for _, excluded := range cluster.ExcludeAutoscalingGroups {
+		if excluded == name {
+			return false
+		}
+	}
+	if len(cluster.IncludeAutoscalingGroups) == 0 {
+		return true
+	}
+	for _, included := range cluster.IncludeAutoscalingGroups {
+		if included == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,491 @@
+package rotator_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	k8sTools "github.com/mattermost/rotator/k8s"
+	"github.com/mattermost/rotator/model"
+	"github.com/mattermost/rotator/rotator"
+	"github.com/mattermost/rotator/simulation"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newSimulation returns a simulation with fast timings, closed at the end of the test.
+func newSimulation(t *testing.T, options simulation.Options) *simulation.Simulation {
+	t.Helper()
+
+	t.Cleanup(simulation.FastTiming())
+	sim := simulation.New(options)
+	t.Cleanup(sim.Close)
+
+	return sim
+}
+
+func testLogger() *logrus.Entry {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return logrus.NewEntry(logger)
+}
+
+// addNodeGroup adds a node group with a pod on every node, and returns the group.
+func addNodeGroup(t *testing.T, sim *simulation.Simulation, name string, size int, zones ...string) *model.NodeGroup {
+	t.Helper()
+
+	nodeGroup, err := sim.AddNodeGroup(name, size, zones...)
+	if err != nil {
+		t.Fatalf("failed to add node group %s: %v", name, err)
+	}
+	for _, instance := range nodeGroup.Instances {
+		_, err = sim.AddPod(instance.NodeName, "default", "pod-"+instance.ID)
+		if err != nil {
+			t.Fatalf("failed to add pod: %v", err)
+		}
+	}
+
+	return nodeGroup
+}
+
+func getNodeGroup(t *testing.T, sim *simulation.Simulation, name string) *model.NodeGroup {
+	t.Helper()
+
+	nodeGroup, err := sim.Cloud.GetNodeGroup(context.Background(), name)
+	if err != nil {
+		t.Fatalf("failed to get node group %s: %v", name, err)
+	}
+
+	return nodeGroup
+}
+
+func getNode(t *testing.T, sim *simulation.Simulation, name string) *corev1.Node {
+	t.Helper()
+
+	node, err := sim.Kubernetes.Clientset.CoreV1().Nodes().Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get node %s: %v", name, err)
+	}
+
+	return node
+}
+
+func nodeExists(t *testing.T, sim *simulation.Simulation, name string) bool {
+	t.Helper()
+
+	nodes, err := sim.Kubernetes.Clientset.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list nodes: %v", err)
+	}
+	for _, node := range nodes.Items {
+		if node.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// assertReplaced checks that none of the original instances is left in the
+// node group, which has the same size with ready nodes.
+func assertReplaced(t *testing.T, sim *simulation.Simulation, original *model.NodeGroup) {
+	t.Helper()
+
+	nodeGroup := getNodeGroup(t, sim, original.Name)
+	if len(nodeGroup.Instances) != len(original.Instances) {
+		t.Fatalf("node group %s has %d instances, expected %d", original.Name, len(nodeGroup.Instances), len(original.Instances))
+	}
+
+	terminated := sim.Cloud.TerminatedInstances()
+	for _, instance := range original.Instances {
+		if nodeGroup.HasInstance(instance.ID) {
+			t.Errorf("instance %s of node group %s was not replaced", instance.ID, original.Name)
+		}
+		if !contains(terminated, instance.ID) {
+			t.Errorf("instance %s of node group %s was not terminated", instance.ID, original.Name)
+		}
+		if nodeExists(t, sim, instance.NodeName) {
+			t.Errorf("node %s was not removed from the cluster", instance.NodeName)
+		}
+	}
+	for _, instance := range nodeGroup.Instances {
+		if !isReady(getNode(t, sim, instance.NodeName)) {
+			t.Errorf("replacement node %s is not ready", instance.NodeName)
+		}
+	}
+}
+
+func TestRotateCluster(t *testing.T) {
+	sim := newSimulation(t, simulation.Options{
+		ReplacementDelay: 20 * time.Millisecond,
+		JoinDelay:        20 * time.Millisecond,
+	})
+	masters := addNodeGroup(t, sim, "master-cluster1", 1)
+	workers := addNodeGroup(t, sim, "nodes-cluster1", 3, "us-east-1a", "us-east-1b")
+
+	metadata, err := rotator.InitRotateCluster(sim.Cluster("cluster1"), &rotator.RotatorMetadata{}, testLogger())
+	if err != nil {
+		t.Fatalf("rotation failed: %v", err)
+	}
+
+	assertReplaced(t, sim, masters)
+	assertReplaced(t, sim, workers)
+	if evictions := sim.Kubernetes.Evictions(); len(evictions) != 4 {
+		t.Errorf("%d pods evicted, expected 4: %v", len(evictions), evictions)
+	}
+	for _, group := range append(metadata.MasterGroups, metadata.WorkerGroups...) {
+		if len(group.Nodes) > 0 || len(group.Errors) > 0 {
+			t.Errorf("autoscaling group %s has nodes %v left and errors %v", group.Name, group.Nodes, group.Errors)
+		}
+	}
+}
+
+func TestRotateClusterSlowReplacement(t *testing.T) {
+	sim := newSimulation(t, simulation.Options{
+		ReplacementDelay: 300 * time.Millisecond,
+		JoinDelay:        300 * time.Millisecond,
+	})
+	workers := addNodeGroup(t, sim, "nodes-cluster1", 2)
+
+	cluster := sim.Cluster("cluster1")
+	cluster.MaxScaling = 2
+	_, err := rotator.InitRotateCluster(cluster, &rotator.RotatorMetadata{}, testLogger())
+	if err != nil {
+		t.Fatalf("rotation failed: %v", err)
+	}
+
+	assertReplaced(t, sim, workers)
+}
+
+func TestRotateClusterReplacementNeverJoins(t *testing.T) {
+	sim := newSimulation(t, simulation.Options{
+		ReplacementDelay: 20 * time.Millisecond,
+		NeverJoin: func(groupName string) bool {
+			return groupName == "nodes-cluster1"
+		},
+	})
+	k8sTools.NodeReadyTimeout = 500 * time.Millisecond
+	workers := addNodeGroup(t, sim, "nodes-cluster1", 2)
+
+	metadata, err := rotator.InitRotateCluster(sim.Cluster("cluster1"), &rotator.RotatorMetadata{}, testLogger())
+	if err == nil {
+		t.Fatal("rotation succeeded, expected the replacement to never become ready")
+	}
+	if !strings.Contains(err.Error(), "failed to get ready") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The rotation stops with the node of the batch detached but neither
+	// cordoned nor terminated, and its replacement left in the group.
+	nodeGroup := getNodeGroup(t, sim, workers.Name)
+	if len(nodeGroup.Instances) != len(workers.Instances) {
+		t.Fatalf("node group has %d instances, expected %d", len(nodeGroup.Instances), len(workers.Instances))
+	}
+	var detached []model.Instance
+	for _, instance := range workers.Instances {
+		if !nodeGroup.HasInstance(instance.ID) {
+			detached = append(detached, instance)
+		}
+	}
+	if len(detached) != 1 {
+		t.Fatalf("%d instances detached, expected 1", len(detached))
+	}
+	if getNode(t, sim, detached[0].NodeName).Spec.Unschedulable {
+		t.Errorf("node %s was cordoned before its replacement was ready", detached[0].NodeName)
+	}
+	if terminated := sim.Cloud.TerminatedInstances(); len(terminated) != 0 {
+		t.Errorf("instances %v were terminated", terminated)
+	}
+	if len(metadata.WorkerGroups) != 1 || len(metadata.WorkerGroups[0].Nodes) != len(workers.Instances) {
+		t.Errorf("nodes removed from the rotation list: %+v", metadata.WorkerGroups)
+	}
+}
+
+func TestRotateClusterReplacementNeverJoinsRollback(t *testing.T) {
+	sim := newSimulation(t, simulation.Options{
+		ReplacementDelay: 20 * time.Millisecond,
+		NeverJoin: func(groupName string) bool {
+			return groupName == "nodes-cluster1"
+		},
+	})
+	k8sTools.NodeReadyTimeout = 500 * time.Millisecond
+	workers := addNodeGroup(t, sim, "nodes-cluster1", 2)
+
+	cluster := sim.Cluster("cluster1")
+	cluster.FailurePolicy = model.FailurePolicyRollback
+	metadata, err := rotator.InitRotateCluster(cluster, &rotator.RotatorMetadata{}, testLogger())
+	if err == nil {
+		t.Fatal("rotation succeeded, expected the replacement to never become ready")
+	}
+	if !strings.Contains(err.Error(), "rolled back nodes") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The replacement is terminated and the original instances are back in service.
+	nodeGroup := getNodeGroup(t, sim, workers.Name)
+	if len(nodeGroup.Instances) != len(workers.Instances) {
+		t.Fatalf("node group has %d instances, expected %d", len(nodeGroup.Instances), len(workers.Instances))
+	}
+	for _, instance := range workers.Instances {
+		if !nodeGroup.HasInstance(instance.ID) {
+			t.Errorf("instance %s was not returned to the node group", instance.ID)
+		}
+		if getNode(t, sim, instance.NodeName).Spec.Unschedulable {
+			t.Errorf("node %s was left cordoned", instance.NodeName)
+		}
+	}
+	terminated := sim.Cloud.TerminatedInstances()
+	if len(terminated) != 1 || contains([]string{workers.Instances[0].ID, workers.Instances[1].ID}, terminated[0]) {
+		t.Errorf("terminated instances %v, expected only the replacement", terminated)
+	}
+	if len(metadata.WorkerGroups) != 1 || len(metadata.WorkerGroups[0].RolledBack) == 0 {
+		t.Errorf("rollback not recorded: %+v", metadata.WorkerGroups)
+	}
+}
+
+func TestRotateClusterPDBCountsBatch(t *testing.T) {
+	sim := newSimulation(t, simulation.Options{
+		ReplacementDelay: 20 * time.Millisecond,
+		JoinDelay:        20 * time.Millisecond,
+	})
+	workers := addNodeGroup(t, sim, "nodes-cluster1", 2)
+
+	// The budget allows one of the two pods to be evicted, so it allows either
+	// node to be drained on its own but not both of them together.
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pods"},
+		Spec:       policyv1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{}},
+		Status:     policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: 1},
+	}
+	_, err := sim.Kubernetes.Clientset.PolicyV1().PodDisruptionBudgets(pdb.Namespace).Create(context.Background(), pdb, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("failed to create PodDisruptionBudget: %v", err)
+	}
+
+	cluster := sim.Cluster("cluster1")
+	cluster.MaxScaling = 2
+	cluster.PDBPolicy = model.PDBPolicyRefuse
+	metadata, err := rotator.InitRotateCluster(cluster, &rotator.RotatorMetadata{}, testLogger())
+	if err == nil {
+		t.Fatal("rotation succeeded, expected the PodDisruptionBudget to refuse the batch")
+	}
+	if !strings.Contains(err.Error(), "default/pods do not allow the nodes to be drained") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if evictions := sim.Kubernetes.Evictions(); len(evictions) != 0 {
+		t.Errorf("pods %v evicted, expected none", evictions)
+	}
+	nodeGroup := getNodeGroup(t, sim, workers.Name)
+	for _, instance := range workers.Instances {
+		if !nodeGroup.HasInstance(instance.ID) {
+			t.Errorf("instance %s was taken out of the node group", instance.ID)
+		}
+	}
+	if len(metadata.WorkerGroups) != 1 || len(metadata.WorkerGroups[0].BlockingPDBs) != len(workers.Instances) {
+		t.Fatalf("expected the PodDisruptionBudget to be recorded for every node: %+v", metadata.WorkerGroups)
+	}
+	for _, blockingPDB := range metadata.WorkerGroups[0].BlockingPDBs {
+		if blockingPDB.Namespace != pdb.Namespace || blockingPDB.Name != pdb.Name {
+			t.Errorf("unexpected blocking PodDisruptionBudget %+v", blockingPDB)
+		}
+	}
+}
+
+func TestDrainNodes(t *testing.T) {
+	tests := []struct {
+		name             string
+		evictionFailures int
+		expectError      bool
+	}{
+		{
+			name:             "evictions failing then succeeding",
+			evictionFailures: 2,
+		},
+		{
+			name:             "evictions always failing",
+			evictionFailures: -1,
+			expectError:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sim := newSimulation(t, simulation.Options{})
+			workers := addNodeGroup(t, sim, "nodes-cluster1", 1)
+			instance := workers.Instances[0]
+			sim.Kubernetes.FailEvictions("default", "pod-"+instance.ID, test.evictionFailures, nil)
+
+			autoscalingGroup := &rotator.AutoscalingGroup{
+				Name:            workers.Name,
+				DesiredCapacity: 1,
+				Nodes:           []string{instance.NodeName},
+			}
+			drainOptions := &rotator.DrainOptions{
+				DeleteLocalData:    true,
+				IgnoreDaemonsets:   true,
+				Timeout:            10,
+				GracePeriodSeconds: -1,
+			}
+			err := autoscalingGroup.DrainNodes(context.Background(), autoscalingGroup.Nodes, 3, drainOptions, 0, 0, sim.Kubernetes.Clientset, sim.Cloud, testLogger(), "worker")
+
+			terminated := contains(sim.Cloud.TerminatedInstances(), instance.ID)
+			if test.expectError {
+				if err == nil || !strings.Contains(err.Error(), "Failed to drain node") {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if terminated || !nodeExists(t, sim, instance.NodeName) {
+					t.Error("node was terminated although it failed to drain")
+				}
+				if len(autoscalingGroup.Nodes) != 1 {
+					t.Errorf("node removed from the rotation list: %v", autoscalingGroup.Nodes)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("drain failed: %v", err)
+			}
+			if !terminated || nodeExists(t, sim, instance.NodeName) {
+				t.Error("drained node was not terminated and removed")
+			}
+			if len(autoscalingGroup.Nodes) != 0 {
+				t.Errorf("node left in the rotation list: %v", autoscalingGroup.Nodes)
+			}
+			if evictions := sim.Kubernetes.Evictions(); len(evictions) != 1 {
+				t.Errorf("%d pods evicted, expected 1", len(evictions))
+			}
+		})
+	}
+}
+
+func TestDrainCancelled(t *testing.T) {
+	sim := newSimulation(t, simulation.Options{})
+	workers := addNodeGroup(t, sim, "nodes-cluster1", 2)
+
+	// The evictions are refused until the drain is cancelled, and the first
+	// node was cordoned by an operator before the drain.
+	var nodes []*corev1.Node
+	for i, instance := range workers.Instances {
+		sim.Kubernetes.FailEvictions("default", "pod-"+instance.ID, -1, apierrors.NewTooManyRequests("disruption budget", 1))
+		node := getNode(t, sim, instance.NodeName)
+		if i == 0 {
+			node.Spec.Unschedulable = true
+			_, err := sim.Kubernetes.Clientset.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{})
+			if err != nil {
+				t.Fatalf("failed to cordon node %s: %v", node.Name, err)
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	drainOptions := &rotator.DrainOptions{
+		DeleteLocalData:    true,
+		IgnoreDaemonsets:   true,
+		Timeout:            10,
+		GracePeriodSeconds: -1,
+	}
+	err := rotator.Drain(ctx, sim.Kubernetes.Clientset, nodes, drainOptions, 0, testLogger())
+	if err == nil {
+		t.Fatal("drain succeeded, expected it to be cancelled")
+	}
+
+	// Only the node cordoned by the drain is uncordoned.
+	if !getNode(t, sim, nodes[0].Name).Spec.Unschedulable {
+		t.Errorf("node %s cordoned before the drain was uncordoned", nodes[0].Name)
+	}
+	if getNode(t, sim, nodes[1].Name).Spec.Unschedulable {
+		t.Errorf("node %s cordoned by the drain was left cordoned", nodes[1].Name)
+	}
+}
+
+func TestInitDrainNode(t *testing.T) {
+	tests := []struct {
+		name             string
+		evictionFailures int
+		expectError      bool
+	}{
+		{
+			name: "drained",
+		},
+		{
+			name:             "evictions always failing",
+			evictionFailures: -1,
+			expectError:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sim := newSimulation(t, simulation.Options{
+				ReplacementDelay: 20 * time.Millisecond,
+				JoinDelay:        20 * time.Millisecond,
+			})
+			workers := addNodeGroup(t, sim, "nodes-cluster1", 2)
+			instance := workers.Instances[0]
+			if test.evictionFailures != 0 {
+				sim.Kubernetes.FailEvictions("default", "pod-"+instance.ID, test.evictionFailures, nil)
+			}
+
+			err := rotator.InitDrainNode(sim.NodeDrain("cluster1", instance.NodeName), testLogger())
+
+			terminated := contains(sim.Cloud.TerminatedInstances(), instance.ID)
+			if test.expectError {
+				if err == nil || !strings.Contains(err.Error(), "Failed to drain node") {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if terminated || !nodeExists(t, sim, instance.NodeName) {
+					t.Error("node was terminated although it failed to drain")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("drain failed: %v", err)
+			}
+			if !terminated || nodeExists(t, sim, instance.NodeName) {
+				t.Error("drained node was not terminated and removed")
+			}
+			if evictions := sim.Kubernetes.Evictions(); len(evictions) != 1 {
+				t.Errorf("%d pods evicted, expected 1", len(evictions))
+			}
+
+			// The detached node is replaced by its node group.
+			nodeGroup, err := sim.Cloud.WaitForCapacity(context.Background(), workers.Name, 2, testLogger())
+			if err != nil {
+				t.Fatalf("node group did not replace the node: %v", err)
+			}
+			if nodeGroup.HasInstance(instance.ID) {
+				t.Error("drained instance is still in the node group")
+			}
+		})
+	}
+}
@@ -0,0 +1,657 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/rotator/model"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Cloud is a fake cloud implementing model.NodeGroupProvider. Like an AWS
+// autoscaling group, a node group launches new instances whenever it has
+// fewer instances than its desired capacity, and the instances register as
+// nodes in the fake Kubernetes cluster.
+type Cloud struct {
+	kubernetes *Kubernetes
+	options    Options
+
+	mu         sync.Mutex
+	groups     []*nodeGroup
+	instances  map[string]*instance
+	terminated []string
+	launched   int
+	timers     []*time.Timer
+	closed     bool
+}
+
+// nodeGroup is a simulated autoscaling group.
+type nodeGroup struct {
+	name            string
+	desiredCapacity int
+	maxSize         int
+	zones           []string
+	tags            map[string]string
+	suspended       map[string]bool
+	launch          launchConfiguration
+	instances       []*instance
+}
+
+// launchConfiguration is what instances are launched with.
+type launchConfiguration struct {
+	name         string
+	imageID      string
+	instanceType string
+}
+
+// instance is a simulated cloud instance.
+type instance struct {
+	id         string
+	nodeName   string
+	zone       string
+	launch     launchConfiguration
+	launchTime time.Time
+	standby    bool
+	terminated bool
+}
+
+// NewCloud creates a fake cloud registering its instances as nodes of the given fake cluster.
+func NewCloud(kubernetes *Kubernetes, options Options) *Cloud {
+	return &Cloud{
+		kubernetes: kubernetes,
+		options:    options,
+		instances:  make(map[string]*instance),
+	}
+}
+
+// AddNodeGroup creates a node group with the given number of instances,
+// spread across the availability zones. The max size of the group is its
+// initial size. The nodes of the initial instances
+// are ready right away.
+func (c *Cloud) AddNodeGroup(name string, size int, zones ...string) (*model.NodeGroup, error) {
+	if len(zones) == 0 {
+		zones = []string{"us-east-1a"}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.group(name) != nil {
+		return nil, errors.Errorf("node group %s already exists", name)
+	}
+
+	group := &nodeGroup{
+		name:            name,
+		desiredCapacity: size,
+		maxSize:         size,
+		zones:           zones,
+		launch: launchConfiguration{
+			name:         fmt.Sprintf("launch-template/lt-%s/1", name),
+			imageID:      "ami-00000001",
+			instanceType: "m5.large",
+		},
+	}
+	c.groups = append(c.groups, group)
+
+	for i := 0; i < size; i++ {
+		instance := c.newInstance(group)
+		err := c.kubernetes.AddNode(instance.nodeName, instance.providerID(), true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return group.snapshot(), nil
+}
+
+// UpdateLaunchConfiguration changes what the node group launches new
+// instances with. Empty values are left unchanged. Existing instances keep
+// running with their original configuration.
+func (c *Cloud) UpdateLaunchConfiguration(groupName, launchConfiguration, imageID, instanceType string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group := c.group(groupName)
+	if group == nil {
+		return errors.Errorf("node group %s not found", groupName)
+	}
+
+	if launchConfiguration != "" {
+		group.launch.name = launchConfiguration
+	}
+	if imageID != "" {
+		group.launch.imageID = imageID
+	}
+	if instanceType != "" {
+		group.launch.instanceType = instanceType
+	}
+
+	return nil
+}
+
+// SetLaunchTime changes when the instance backing the node was launched.
+func (c *Cloud) SetLaunchTime(nodeName string, launchTime time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	instance := c.instance(nodeName)
+	if instance == nil {
+		return errors.Errorf("instance of node %s not found", nodeName)
+	}
+	instance.launchTime = launchTime
+
+	return nil
+}
+
+// TerminatedInstances returns the IDs of the instances terminated so far, in order.
+func (c *Cloud) TerminatedInstances() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.terminated...)
+}
+
+// Close stops launching instances and registering nodes.
+func (c *Cloud) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for _, timer := range c.timers {
+		timer.Stop()
+	}
+	c.timers = nil
+}
+
+// GetNodeGroups returns the node groups of the cluster identified by the
+// selector. Node groups that were never tagged belong to the clusters whose
+// IDs their names contain, and are groups of masters if their names contain
+// "master".
+func (c *Cloud) GetNodeGroups(ctx context.Context, selector *model.NodeGroupSelector) ([]*model.NodeGroup, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var nodeGroups []*model.NodeGroup
+	for _, group := range c.groups {
+		nodeGroup := group.snapshot()
+		matches := selector.Matches(group.name, group.tags)
+		if group.tags == nil {
+			matches = matches || len(selector.Names) == 0 && strings.Contains(group.name, selector.ClusterID)
+			nodeGroup.Master = strings.Contains(group.name, "master")
+		} else {
+			nodeGroup.Master = selector.IsMaster(group.tags)
+		}
+		if matches {
+			nodeGroups = append(nodeGroups, nodeGroup)
+		}
+	}
+
+	return nodeGroups, nil
+}
+
+// TagNodeGroup adds the tags to the node group.
+func (c *Cloud) TagNodeGroup(name string, tags map[string]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group := c.group(name)
+	if group == nil {
+		return errors.Errorf("node group %s not found", name)
+	}
+	if group.tags == nil {
+		group.tags = make(map[string]string)
+	}
+	for key, value := range tags {
+		group.tags[key] = value
+	}
+
+	return nil
+}
+
+// GetNodeGroup returns the node group with the given name.
+func (c *Cloud) GetNodeGroup(ctx context.Context, name string) (*model.NodeGroup, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group := c.group(name)
+	if group == nil {
+		return nil, errors.Errorf("node group %s not found", name)
+	}
+
+	return group.snapshot(), nil
+}
+
+// GetInstanceID returns the ID of the instance backing the node.
+func (c *Cloud) GetInstanceID(ctx context.Context, nodeName string, logger *logrus.Entry) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	instance := c.instance(nodeName)
+	if instance == nil {
+		logger.Warnf("Instance %s not found, assuming that instance was already deleted", nodeName)
+		return "", nil
+	}
+
+	return instance.id, nil
+}
+
+// DetachNodes removes the instances from the node group.
+// Unless the desired capacity is decremented, the node group launches
+// replacements after the replacement delay.
+func (c *Cloud) DetachNodes(ctx context.Context, decrement bool, instanceIDs []string, groupName string, logger *logrus.Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group := c.group(groupName)
+	if group == nil {
+		return errors.Errorf("node group %s not found", groupName)
+	}
+
+	for _, instanceID := range instanceIDs {
+		instance := c.instances[instanceID]
+		if instance == nil {
+			logger.Infof("Instance %s does not exist. No detachment required", instanceID)
+			continue
+		}
+		if !group.remove(instance) {
+			continue
+		}
+
+		logger.Infof("Detaching instance %s", instance.id)
+		if decrement {
+			group.desiredCapacity--
+		}
+	}
+	c.scheduleReplacement(group)
+
+	return nil
+}
+
+// AttachNodes adds the running instances to the node group and increments its
+// desired capacity.
+func (c *Cloud) AttachNodes(ctx context.Context, instanceIDs []string, groupName string, logger *logrus.Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group := c.group(groupName)
+	if group == nil {
+		return errors.Errorf("node group %s not found", groupName)
+	}
+
+	for _, instanceID := range instanceIDs {
+		instance := c.instances[instanceID]
+		if instance == nil || instance.terminated {
+			logger.Infof("Instance %s does not exist. No attachment possible", instanceID)
+			continue
+		}
+		if group.has(instance) {
+			continue
+		}
+		if group.desiredCapacity+1 > group.maxSize {
+			return errors.Errorf("attaching instance %s would exceed the max size %d of node group %s", instance.id, group.maxSize, groupName)
+		}
+
+		logger.Infof("Attaching instance %s", instance.id)
+		group.instances = append(group.instances, instance)
+		group.desiredCapacity++
+	}
+
+	return nil
+}
+
+// EnterStandby puts the instances in standby. Unless the
+// desired capacity is decremented, the node group launches replacements after
+// the replacement delay.
+func (c *Cloud) EnterStandby(ctx context.Context, decrement bool, instanceIDs []string, groupName string, logger *logrus.Entry) error {
+	return c.setStandby(instanceIDs, groupName, true, decrement, logger)
+}
+
+// ExitStandby returns the instances to service and increments the desired
+// capacity of the node group.
+func (c *Cloud) ExitStandby(ctx context.Context, instanceIDs []string, groupName string, logger *logrus.Entry) error {
+	return c.setStandby(instanceIDs, groupName, false, false, logger)
+}
+
+func (c *Cloud) setStandby(instanceIDs []string, groupName string, standby, decrement bool, logger *logrus.Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group := c.group(groupName)
+	if group == nil {
+		return errors.Errorf("node group %s not found", groupName)
+	}
+
+	for _, instanceID := range instanceIDs {
+		instance := c.instances[instanceID]
+		if instance == nil || !group.has(instance) || instance.standby == standby {
+			logger.Infof("Instance %s cannot change standby state, skipping", instanceID)
+			continue
+		}
+
+		instance.standby = standby
+		if standby {
+			logger.Infof("Putting instance %s in standby", instance.id)
+			if decrement {
+				group.desiredCapacity--
+			}
+		} else {
+			logger.Infof("Returning instance %s to service", instance.id)
+			group.desiredCapacity++
+		}
+	}
+	c.scheduleReplacement(group)
+
+	return nil
+}
+
+// TerminateNodes terminates the instances and removes their nodes from the
+// cluster. Node groups replace their terminated instances.
+func (c *Cloud) TerminateNodes(ctx context.Context, instanceIDs []string, logger *logrus.Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	logger.Infof("Terminating %d nodes", len(instanceIDs))
+	for _, instanceID := range instanceIDs {
+		instance := c.instances[instanceID]
+		if instance == nil {
+			logger.Infof("Instance %s does not exist. No termination required", instanceID)
+			continue
+		}
+		if instance.terminated {
+			continue
+		}
+
+		logger.Infof("Terminating instance %s", instance.id)
+		instance.terminated = true
+		c.terminated = append(c.terminated, instance.id)
+		for _, group := range c.groups {
+			if group.remove(instance) {
+				c.scheduleReplacement(group)
+			}
+		}
+
+		err := c.kubernetes.DeleteNode(instance.nodeName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WaitForCapacity waits until the node group has the desired number of instances.
+func (c *Cloud) WaitForCapacity(ctx context.Context, groupName string, desiredCapacity int, logger *logrus.Entry) (*model.NodeGroup, error) {
+	timer := time.NewTimer(c.options.capacityTimeout())
+	defer timer.Stop()
+
+	for {
+		nodeGroup, err := c.GetNodeGroup(ctx, groupName)
+		if err != nil {
+			return nil, err
+		}
+		inService := 0
+		for _, instance := range nodeGroup.Instances {
+			if !instance.Standby {
+				inService++
+			}
+		}
+		if inService == desiredCapacity {
+			return nodeGroup, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "stopped waiting for node group capacity")
+		case <-timer.C:
+			return nil, errors.Errorf("timed out waiting for node group %s to have %d instances", groupName, desiredCapacity)
+		case <-time.After(capacityInterval):
+		}
+	}
+}
+
+// SetCapacity changes the desired capacity and max size of the node group.
+// The node group launches or terminates instances after the replacement delay.
+func (c *Cloud) SetCapacity(ctx context.Context, groupName string, desiredCapacity, maxSize int, logger *logrus.Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group := c.group(groupName)
+	if group == nil {
+		return errors.Errorf("node group %s not found", groupName)
+	}
+	if desiredCapacity > maxSize {
+		return errors.Errorf("desired capacity %d of node group %s is above its max size %d", desiredCapacity, groupName, maxSize)
+	}
+
+	logger.Infof("Setting desired capacity of node group %s to %d and max size to %d", groupName, desiredCapacity, maxSize)
+	group.desiredCapacity = desiredCapacity
+	group.maxSize = maxSize
+	c.scheduleReplacement(group)
+
+	return nil
+}
+
+// SuspendProcesses suspends the processes of the node group. Suspended
+// processes are only recorded, they do not change how the group behaves.
+func (c *Cloud) SuspendProcesses(ctx context.Context, groupName string, processes []string, logger *logrus.Entry) error {
+	return c.setSuspended(groupName, processes, true, logger)
+}
+
+// ResumeProcesses resumes the suspended processes of the node group.
+func (c *Cloud) ResumeProcesses(ctx context.Context, groupName string, processes []string, logger *logrus.Entry) error {
+	return c.setSuspended(groupName, processes, false, logger)
+}
+
+func (c *Cloud) setSuspended(groupName string, processes []string, suspended bool, logger *logrus.Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group := c.group(groupName)
+	if group == nil {
+		return errors.Errorf("node group %s not found", groupName)
+	}
+
+	logger.Infof("Setting processes %s of node group %s suspended: %t", strings.Join(processes, ", "), groupName, suspended)
+	if group.suspended == nil {
+		group.suspended = make(map[string]bool)
+	}
+	for _, process := range processes {
+		if suspended {
+			group.suspended[process] = true
+		} else {
+			delete(group.suspended, process)
+		}
+	}
+
+	return nil
+}
+
+// scheduleReplacement launches or terminates instances in the group after the
+// replacement delay until it reaches its desired capacity, terminating the
+// newest instances first. Must be called with the lock held.
+func (c *Cloud) scheduleReplacement(group *nodeGroup) {
+	c.afterFunc(c.options.ReplacementDelay, func() {
+		for group.inService() > group.desiredCapacity {
+			instance := group.newestInService()
+			group.remove(instance)
+			instance.terminated = true
+			c.terminated = append(c.terminated, instance.id)
+			_ = c.kubernetes.DeleteNode(instance.nodeName)
+		}
+		for group.inService() < group.desiredCapacity {
+			instance := c.newInstance(group)
+			if c.options.NeverJoin != nil && c.options.NeverJoin(group.name) {
+				continue
+			}
+
+			_ = c.kubernetes.AddNode(instance.nodeName, instance.providerID(), false)
+			c.afterFunc(c.options.JoinDelay, func() {
+				_ = c.kubernetes.SetNodeReady(instance.nodeName, true)
+			})
+		}
+	})
+}
+
+// afterFunc calls f with the lock held after the given delay, unless the
+// cloud is closed. Must be called with the lock held.
+func (c *Cloud) afterFunc(delay time.Duration, f func()) {
+	if c.closed {
+		return
+	}
+
+	c.timers = append(c.timers, time.AfterFunc(delay, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.closed {
+			return
+		}
+		f()
+	}))
+}
+
+// newInstance launches an instance in the group. Must be called with the lock held.
+func (c *Cloud) newInstance(group *nodeGroup) *instance {
+	c.launched++
+	instance := &instance{
+		id:         fmt.Sprintf("i-%017x", c.launched),
+		nodeName:   fmt.Sprintf("ip-10-0-%d-%d.ec2.internal", c.launched/250, c.launched%250+1),
+		zone:       group.nextZone(),
+		launch:     group.launch,
+		launchTime: time.Now(),
+	}
+	c.instances[instance.id] = instance
+	group.instances = append(group.instances, instance)
+
+	return instance
+}
+
+// group returns the group with the given name. Must be called with the lock held.
+func (c *Cloud) group(name string) *nodeGroup {
+	for _, group := range c.groups {
+		if group.name == name {
+			return group
+		}
+	}
+
+	return nil
+}
+
+// instance returns the instance with the given ID or node name. Must be
+// called with the lock held.
+func (c *Cloud) instance(nodeName string) *instance {
+	if instance, ok := c.instances[nodeName]; ok {
+		return instance
+	}
+	for _, instance := range c.instances {
+		if instance.nodeName == nodeName {
+			return instance
+		}
+	}
+
+	return nil
+}
+
+// providerID returns the provider ID of the node backed by the instance.
+func (i *instance) providerID() string {
+	return fmt.Sprintf("aws:///%s/%s", i.zone, i.id)
+}
+
+// nextZone returns the availability zone with the fewest instances of the
+// group, balancing the group across its zones.
+func (g *nodeGroup) nextZone() string {
+	counts := make(map[string]int)
+	for _, instance := range g.instances {
+		counts[instance.zone]++
+	}
+
+	zone := g.zones[0]
+	for _, candidate := range g.zones[1:] {
+		if counts[candidate] < counts[zone] {
+			zone = candidate
+		}
+	}
+
+	return zone
+}
+
+// inService returns the number of instances of the group that are not in standby.
+func (g *nodeGroup) inService() int {
+	count := 0
+	for _, instance := range g.instances {
+		if !instance.standby {
+			count++
+		}
+	}
+
+	return count
+}
+
+// newestInService returns the most recently launched instance that is not in standby.
+func (g *nodeGroup) newestInService() *instance {
+	for i := len(g.instances) - 1; i >= 0; i-- {
+		if !g.instances[i].standby {
+			return g.instances[i]
+		}
+	}
+
+	return nil
+}
+
+// has returns true if the instance is a member of the group.
+func (g *nodeGroup) has(instance *instance) bool {
+	for _, member := range g.instances {
+		if member == instance {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remove removes the instance from the group, returning false if it was not a member.
+func (g *nodeGroup) remove(instance *instance) bool {
+	for i, member := range g.instances {
+		if member == instance {
+			g.instances = append(g.instances[:i], g.instances[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// snapshot returns a copy of the group.
+func (g *nodeGroup) snapshot() *model.NodeGroup {
+	nodeGroup := &model.NodeGroup{
+		Name:                g.name,
+		DesiredCapacity:     g.desiredCapacity,
+		MaxSize:             g.maxSize,
+		LaunchConfiguration: g.launch.name,
+		ImageID:             g.launch.imageID,
+		InstanceType:        g.launch.instanceType,
+	}
+	for process := range g.suspended {
+		nodeGroup.SuspendedProcesses = append(nodeGroup.SuspendedProcesses, process)
+	}
+	sort.Strings(nodeGroup.SuspendedProcesses)
+	for _, instance := range g.instances {
+		nodeGroup.Instances = append(nodeGroup.Instances, model.Instance{
+			ID:                  instance.id,
+			NodeName:            instance.nodeName,
+			AvailabilityZone:    instance.zone,
+			LaunchConfiguration: instance.launch.name,
+			ImageID:             instance.launch.imageID,
+			InstanceType:        instance.launch.instanceType,
+			LaunchTime:          instance.launchTime,
+			Standby:             instance.standby,
+		})
+	}
+
+	return nodeGroup
+}
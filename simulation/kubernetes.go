@@ -0,0 +1,307 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var (
+	podsResource = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	podsKind     = schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+)
+
+// Kubernetes is a fake Kubernetes API server. Pods are listed by node,
+// evictions delete the evicted pod and can be made to fail.
+type Kubernetes struct {
+	Clientset *fake.Clientset
+
+	mu               sync.Mutex
+	evictionFailures map[string]*evictionFailure
+	evictions        []string
+	podCount         int
+}
+
+// evictionFailure is an error returned by the evictions of a pod.
+type evictionFailure struct {
+	err   error
+	times int
+}
+
+// NewKubernetes creates a fake Kubernetes API server supporting pod evictions.
+func NewKubernetes() *Kubernetes {
+	k := &Kubernetes{
+		Clientset:        fake.NewSimpleClientset(),
+		evictionFailures: make(map[string]*evictionFailure),
+	}
+
+	k.ServePolicyVersions("policy/v1", "policy/v1beta1")
+	k.Clientset.PrependReactor("list", "pods", k.listPods)
+	k.Clientset.PrependReactor("create", "pods", k.evictPod)
+
+	return k
+}
+
+// ServePolicyVersions sets the versions of the policy API group listed by
+// discovery, to simulate API servers of different Kubernetes versions.
+// Without any version, evictions are not supported.
+func (k *Kubernetes) ServePolicyVersions(groupVersions ...string) {
+	resources := []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Kind: "Pod", Namespaced: true},
+				{Name: "pods/eviction", Kind: "Eviction", Namespaced: true},
+				{Name: "nodes", Kind: "Node"},
+			},
+		},
+	}
+	for _, groupVersion := range groupVersions {
+		resources = append(resources, &metav1.APIResourceList{
+			GroupVersion: groupVersion,
+			APIResources: []metav1.APIResource{
+				{Name: "poddisruptionbudgets", Kind: "PodDisruptionBudget", Namespaced: true},
+			},
+		})
+	}
+
+	k.Clientset.Discovery().(*fakediscovery.FakeDiscovery).Resources = resources
+}
+
+// listPods filters listed pods by field selector, which the fake clientset ignores.
+func (k *Kubernetes) listPods(action k8stesting.Action) (bool, runtime.Object, error) {
+	listAction, ok := action.(k8stesting.ListAction)
+	if !ok {
+		return false, nil, nil
+	}
+	fieldSelector := listAction.GetListRestrictions().Fields
+	if fieldSelector == nil || fieldSelector.Empty() {
+		return false, nil, nil
+	}
+
+	obj, err := k.Clientset.Tracker().List(podsResource, podsKind, action.GetNamespace())
+	if err != nil {
+		return true, nil, err
+	}
+
+	podList := obj.(*corev1.PodList)
+	filtered := &corev1.PodList{ListMeta: podList.ListMeta}
+	for _, pod := range podList.Items {
+		podFields := fields.Set{
+			"metadata.name":      pod.Name,
+			"metadata.namespace": pod.Namespace,
+			"spec.nodeName":      pod.Spec.NodeName,
+		}
+		if fieldSelector.Matches(podFields) {
+			filtered.Items = append(filtered.Items, pod)
+		}
+	}
+
+	return true, filtered, nil
+}
+
+// evictPod deletes the evicted pod unless its evictions are set to fail.
+func (k *Kubernetes) evictPod(action k8stesting.Action) (bool, runtime.Object, error) {
+	createAction, ok := action.(k8stesting.CreateAction)
+	if !ok || createAction.GetSubresource() != "eviction" {
+		return false, nil, nil
+	}
+
+	eviction, err := meta.Accessor(createAction.GetObject())
+	if err != nil {
+		return true, nil, err
+	}
+	key := fmt.Sprintf("%s/%s", action.GetNamespace(), eviction.GetName())
+
+	k.mu.Lock()
+	failure, found := k.evictionFailures[key]
+	if found {
+		if failure.times > 0 {
+			failure.times--
+		}
+		if failure.times == 0 {
+			delete(k.evictionFailures, key)
+		}
+	}
+	k.mu.Unlock()
+
+	if found {
+		return true, nil, failure.err
+	}
+
+	err = k.Clientset.Tracker().Delete(podsResource, action.GetNamespace(), eviction.GetName())
+	if err != nil {
+		return true, nil, err
+	}
+
+	k.mu.Lock()
+	k.evictions = append(k.evictions, key)
+	k.mu.Unlock()
+
+	return true, nil, nil
+}
+
+// FailEvictions makes the next evictions of a pod fail with the given error,
+// or with an internal server error if none is given. A negative number of
+// times makes all evictions of the pod fail.
+func (k *Kubernetes) FailEvictions(namespace, name string, times int, err error) {
+	if err == nil {
+		err = apierrors.NewInternalError(errors.New("simulated eviction failure"))
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.evictionFailures[fmt.Sprintf("%s/%s", namespace, name)] = &evictionFailure{err: err, times: times}
+}
+
+// Evictions returns the namespaced names of the pods evicted so far, in order.
+func (k *Kubernetes) Evictions() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return append([]string(nil), k.evictions...)
+}
+
+// AddNode registers a node with the given name and provider ID.
+func (k *Kubernetes) AddNode(name, providerID string, ready bool) error {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			UID:  types.UID(name),
+		},
+		Spec: corev1.NodeSpec{
+			ProviderID: providerID,
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{nodeReadyCondition(ready)},
+		},
+	}
+
+	_, err := k.Clientset.CoreV1().Nodes().Create(context.Background(), node, metav1.CreateOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to create node %s", name)
+	}
+
+	return nil
+}
+
+// SetNodeReady marks a node as ready or not ready.
+func (k *Kubernetes) SetNodeReady(name string, ready bool) error {
+	ctx := context.Background()
+
+	node, err := k.Clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get node %s", name)
+	}
+
+	node.Status.Conditions = []corev1.NodeCondition{nodeReadyCondition(ready)}
+	_, err = k.Clientset.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to update node %s", name)
+	}
+
+	return nil
+}
+
+// DeleteNode removes a node and the pods running on it.
+func (k *Kubernetes) DeleteNode(name string) error {
+	ctx := context.Background()
+
+	err := k.Clientset.CoreV1().Nodes().Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete node %s", name)
+	}
+
+	pods, err := k.NodePods(name)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		err = k.Clientset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete pod %s/%s", pod.Namespace, pod.Name)
+		}
+	}
+
+	return nil
+}
+
+// AddPod schedules a pod managed by a ReplicaSet on the node.
+func (k *Kubernetes) AddPod(nodeName, namespace, name string) (*corev1.Pod, error) {
+	k.mu.Lock()
+	k.podCount++
+	uid := types.UID(fmt.Sprintf("pod-%d", k.podCount))
+	k.mu.Unlock()
+
+	controller := true
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			UID:       uid,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1",
+				Kind:       "ReplicaSet",
+				Name:       name,
+				UID:        uid,
+				Controller: &controller,
+			}},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: nodeName,
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+
+	pod, err := k.Clientset.CoreV1().Pods(namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create pod %s/%s", namespace, name)
+	}
+
+	return pod, nil
+}
+
+// NodePods returns the pods scheduled on the node.
+func (k *Kubernetes) NodePods(nodeName string) ([]corev1.Pod, error) {
+	podList, err := k.Clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.Background(), metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list pods of node %s", nodeName)
+	}
+
+	return podList.Items, nil
+}
+
+// nodeReadyCondition returns the Ready condition reported by the kubelet.
+func nodeReadyCondition(ready bool) corev1.NodeCondition {
+	if !ready {
+		return corev1.NodeCondition{
+			Type:   corev1.NodeReady,
+			Status: corev1.ConditionFalse,
+			Reason: "KubeletNotReady",
+		}
+	}
+
+	return corev1.NodeCondition{
+		Type:   corev1.NodeReady,
+		Status: corev1.ConditionTrue,
+		Reason: "KubeletReady",
+	}
+}
@@ -0,0 +1,123 @@
+// Package simulation provides an in-memory cloud and Kubernetes cluster to
+// run rotations and drains end-to-end without an AWS account, for example:
+//
+//	sim := simulation.New(simulation.Options{ReplacementDelay: time.Second})
+//	defer sim.Close()
+//	defer simulation.FastTiming()()
+//
+//	sim.AddNodeGroup("nodes-cluster1", 3)
+//	_, err := rotator.InitRotateCluster(sim.Cluster("cluster1"), &rotator.RotatorMetadata{}, logger)
+package simulation
+
+import (
+	"time"
+
+	k8sTools "github.com/mattermost/rotator/k8s"
+	"github.com/mattermost/rotator/model"
+	"github.com/mattermost/rotator/rotator"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// capacityInterval is how often node group capacity is checked while waiting for it.
+const capacityInterval = 50 * time.Millisecond
+
+// Options configure the behaviour of the simulated cloud.
+type Options struct {
+	// ReplacementDelay is how long a node group takes to launch instances
+	// replacing the ones it lost.
+	ReplacementDelay time.Duration
+	// JoinDelay is how long the node of a launched instance takes to become ready.
+	JoinDelay time.Duration
+	// NeverJoin, if set, is called for every instance launched in a node group
+	// and returns true if the instance should never register as a node.
+	NeverJoin func(groupName string) bool
+	// CapacityTimeout is how long to wait for a node group to reach its
+	// desired capacity. Defaults to 5 minutes.
+	CapacityTimeout time.Duration
+}
+
+func (o Options) capacityTimeout() time.Duration {
+	if o.CapacityTimeout == 0 {
+		return 5 * time.Minute
+	}
+
+	return o.CapacityTimeout
+}
+
+// Simulation is a fake cloud wired to a fake Kubernetes cluster.
+type Simulation struct {
+	Cloud      *Cloud
+	Kubernetes *Kubernetes
+}
+
+// New creates a simulation with no node groups.
+func New(options Options) *Simulation {
+	kubernetes := NewKubernetes()
+
+	return &Simulation{
+		Cloud:      NewCloud(kubernetes, options),
+		Kubernetes: kubernetes,
+	}
+}
+
+// Close stops the simulated cloud from launching instances.
+func (s *Simulation) Close() {
+	s.Cloud.Close()
+}
+
+// AddNodeGroup creates a node group with the given number of ready nodes.
+// Until tagged with Cloud.TagNodeGroup, node groups belong to the clusters
+// whose IDs their names contain, and are rotated as masters if their names
+// contain "master".
+func (s *Simulation) AddNodeGroup(name string, size int, zones ...string) (*model.NodeGroup, error) {
+	return s.Cloud.AddNodeGroup(name, size, zones...)
+}
+
+// AddPod schedules a pod managed by a ReplicaSet on the node.
+func (s *Simulation) AddPod(nodeName, namespace, name string) (*corev1.Pod, error) {
+	return s.Kubernetes.AddPod(nodeName, namespace, name)
+}
+
+// Cluster returns a cluster rotating all of its node groups one node at a time.
+func (s *Simulation) Cluster(clusterID string) *model.Cluster {
+	return &model.Cluster{
+		ClusterID:       clusterID,
+		MaxScaling:      1,
+		RotateMasters:   true,
+		RotateWorkers:   true,
+		MaxDrainRetries: 3,
+		ClientSet:       s.Kubernetes.Clientset,
+		Provider:        s.Cloud,
+	}
+}
+
+// NodeDrain returns a drain of the node that detaches and terminates it.
+func (s *Simulation) NodeDrain(clusterID, nodeName string) *model.NodeDrain {
+	return &model.NodeDrain{
+		NodeName:        nodeName,
+		MaxDrainRetries: 3,
+		DetachNode:      true,
+		TerminateNode:   true,
+		ClusterID:       clusterID,
+		ClientSet:       s.Kubernetes.Clientset,
+		Provider:        s.Cloud,
+	}
+}
+
+// FastTiming shortens the waits of rotations and drains so simulations run
+// in seconds, and returns a function restoring them.
+func FastTiming() func() {
+	balanceWait := rotator.BalanceWait
+	nodeReadyTimeout := k8sTools.NodeReadyTimeout
+	nodeReadyInterval := k8sTools.NodeReadyInterval
+
+	rotator.BalanceWait = 0
+	k8sTools.NodeReadyTimeout = 10 * time.Second
+	k8sTools.NodeReadyInterval = 50 * time.Millisecond
+
+	return func() {
+		rotator.BalanceWait = balanceWait
+		k8sTools.NodeReadyTimeout = nodeReadyTimeout
+		k8sTools.NodeReadyInterval = nodeReadyInterval
+	}
+}